@@ -0,0 +1,78 @@
+package arrivals
+
+import (
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+// Alert is a message of the operator about a stop, e.g. a diversion.
+type Alert struct {
+	ID       string    `json:"id"`
+	Text     string    `json:"text"`
+	Stop     string    `json:"stop"`            // TimingPointCode, e.g. 30001346
+	Lines    []string  `json:"lines,omitempty"` // LinePublicNumbers, all when empty
+	Calamity bool      `json:"calamity,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"` // zero until the operator removes it
+}
+
+// Live reports whether a is in effect at now.
+func (a Alert) Live(now time.Time) bool {
+	return !now.Before(a.Start) && (a.End.IsZero() || now.Before(a.End))
+}
+
+// AlertsFromOVAPI returns the messages of d in effect at now about the timing points
+// and lines of f. Messages without a valid start or with an empty text are left out.
+func AlertsFromOVAPI(d ovapi.Departures, f Filter, now time.Time) []Alert {
+	// Messages name the lines by their planning number, buses by their public one.
+	public := map[string]string{}
+	for _, pass := range d.Passes() {
+		public[pass.LinePlanningNumber] = pass.LinePublicNumber
+	}
+
+	var alerts []Alert
+	for _, m := range d.Messages() {
+		start, err := ParsePassTime(m.MessageStartTime)
+		if err != nil || m.MessageContent == "" {
+			continue
+		}
+		a := Alert{
+			ID:       m.ID,
+			Text:     m.MessageContent,
+			Stop:     m.TimingPointCode,
+			Calamity: m.MessagePriority == "CALAMITY",
+			Start:    start,
+		}
+		if end, err := ParsePassTime(m.MessageEndTime); err == nil {
+			a.End = end
+		}
+		for _, line := range m.LinePlanningNumbers {
+			if p, ok := public[line]; ok {
+				line = p
+			}
+			a.Lines = append(a.Lines, line)
+		}
+
+		if a.Live(now) && f.concerns(a) {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// concerns reports whether a is about the timing points and lines of f.
+func (f Filter) concerns(a Alert) bool {
+	if a.Stop != "" && !oneOf(a.Stop, f.TimingPoints) {
+		return false
+	}
+	if len(a.Lines) == 0 || len(f.Lines) == 0 {
+		return true
+	}
+	for _, line := range a.Lines {
+		if oneOf(line, f.Lines) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package arrivals
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertsFromOVAPI(t *testing.T) {
+	d := fetch(t, "alerts.json")
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, amsterdam)
+
+	ids := func(alerts []Alert) []string {
+		var out []string
+		for _, a := range alerts {
+			out = append(out, a.ID)
+		}
+		return out
+	}
+
+	// Expired, not yet started and empty messages are left out.
+	all := AlertsFromOVAPI(d, Filter{}, now)
+	assert.Equal(t, []string{
+		"GVB_2019-01-02_11_30001346",
+		"GVB_2019-01-02_12_30001346",
+		"GVB_2019-01-02_13_30001346",
+		"GVB_2019-01-02_21_30001345",
+	}, ids(all))
+
+	alerts := AlertsFromOVAPI(d, Filter{Lines: []string{"35"}, TimingPoints: []string{"30001346"}}, now)
+	assert.Equal(t, []string{
+		"GVB_2019-01-02_11_30001346",
+		"GVB_2019-01-02_12_30001346",
+	}, ids(alerts))
+	if assert.Len(t, alerts, 2) {
+		assert.Equal(t, []string{"35"}, alerts[0].Lines, "by public number")
+		assert.Equal(t, "Lijn 35 rijdt om via de Bos en Lommerweg", alerts[0].Text)
+		assert.True(t, alerts[0].End.Equal(time.Date(2019, 1, 2, 23, 0, 0, 0, amsterdam)))
+		assert.False(t, alerts[0].Calamity)
+
+		assert.True(t, alerts[1].Calamity)
+		assert.True(t, alerts[1].End.IsZero(), "until removed")
+	}
+}
+
+func TestAlertLive(t *testing.T) {
+	start := time.Date(2019, 1, 2, 6, 0, 0, 0, time.UTC)
+	a := Alert{Start: start, End: start.Add(time.Hour)}
+	assert.False(t, a.Live(start.Add(-time.Second)))
+	assert.True(t, a.Live(start))
+	assert.False(t, a.Live(start.Add(time.Hour)))
+
+	a.End = time.Time{}
+	assert.True(t, a.Live(start.Add(time.Hour*100)))
+}
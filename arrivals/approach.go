@@ -0,0 +1,37 @@
+package arrivals
+
+import (
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+// Approach is how far a bus still has to go to the stop.
+type Approach struct {
+	Stops  int     `json:"stops"`  // stops to go, 0 when at the stop
+	Meters float64 `json:"meters"` // from stop to stop along the route
+}
+
+// ApproachOf returns how far the bus on journey, its stops in order, still has to go
+// to the stop with UserStopOrderNumber order. The bus is at the last stop it arrived
+// at or passed, so it is only known once it left its first stop.
+func ApproachOf(journey []ovapi.Pass, order int) (Approach, bool) {
+	at := -1
+	for i, stop := range journey {
+		if stop.UserStopOrderNumber > order {
+			break
+		}
+		if stop.TripStopStatus == "PASSED" || stop.TripStopStatus == "ARRIVED" {
+			at = i
+		}
+	}
+	if at < 0 {
+		return Approach{}, false
+	}
+
+	var a Approach
+	for i := at; i < len(journey)-1 && journey[i].UserStopOrderNumber < order; i++ {
+		from, to := journey[i], journey[i+1]
+		a.Stops++
+		a.Meters += ovapi.Distance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+	}
+	return a, true
+}
@@ -0,0 +1,43 @@
+package arrivals
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+func TestApproachOf(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join("testdata", "journey.json"))
+	}))
+	defer srv.Close()
+
+	c := ovapi.NewClient(nil)
+	c.JourneyURL = srv.URL + "/journey/%s"
+	journey, err := c.Journey(context.Background(), "GVB_20181117_35_1101_0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// The bus is at stop 17, stops are about 445 m apart.
+	a, ok := ApproachOf(journey, 21)
+	assert.True(t, ok)
+	assert.Equal(t, 4, a.Stops)
+	assert.InDelta(t, 4*445, a.Meters, 10)
+
+	a, ok = ApproachOf(journey, 17)
+	assert.True(t, ok)
+	assert.Equal(t, Approach{}, a, "at the stop")
+
+	// Not yet left the first stop.
+	for i := range journey {
+		journey[i].TripStopStatus = "PLANNED"
+	}
+	_, ok = ApproachOf(journey, 21)
+	assert.False(t, ok)
+}
@@ -0,0 +1,260 @@
+// Package arrivals turns the passes of OVAPI into the buses on the display,
+// keeping only the ones of interest.
+package arrivals
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+// Bus is an upcoming bus.
+type Bus struct {
+	LineNumber               string        `json:"line_number"`
+	TransportType            string        `json:"transport_type,omitempty"` // BUS, TRAM, METRO or BOAT
+	TripStatus               string        `json:"trip_status"`
+	FinalDestinationName     string        `json:"final_destination_name"`
+	FinalDestinationCode     string        `json:"final_destination_code"`
+	LineDirection            int           `json:"line_direction,omitempty"`             // 1 or 2, 0 when unknown
+	TimingPointCode          string        `json:"timing_point_code,omitempty"`          // e.g. 30001346
+	UserStopCode             string        `json:"user_stop_code,omitempty"`             // e.g. 01346
+	WheelchairAccessible     string        `json:"wheelchair_accessible,omitempty"`      // of the vehicle, ACCESSIBLE, NOTACCESSIBLE or UNKNOWN
+	StopWheelchairAccessible string        `json:"stop_wheelchair_accessible,omitempty"` // of the timing point, likewise
+	CompiledArrivalTime      time.Time     `json:"compiled_arrival_time"`                // compiled ETA
+	PlannedArrivalTime       time.Time     `json:"planned_arrival_time"`                 // scheduled ETA
+	LastUpdateTimestamp      time.Time     `json:"last_update_timestamp"`
+	DelaySeconds             int           `json:"delay_seconds"`        // compiled minus scheduled ETA
+	Corrected                bool          `json:"corrected,omitempty"`  // ETA adjusted by the learned bias
+	Scheduled                bool          `json:"scheduled,omitempty"`  // from the static timetable, no realtime data
+	Watch                    string        `json:"watch,omitempty"`      // name of the watch the bus was kept by
+	WalkTime                 time.Duration `json:"-"`                    // of the watch, to the stop
+	Journey                  string        `json:"journey,omitempty"`    // e.g. GVB_20181117_35_1101_0
+	StopOrder                int           `json:"stop_order,omitempty"` // UserStopOrderNumber of the stop in the journey
+	Approach                 *Approach     `json:"approach,omitempty"`   // how far the bus still has to go, when known
+}
+
+// Wheelchair accessibility of a vehicle or stop in OVAPI. Anything else, like UNKNOWN, is not known.
+const (
+	Accessible    = "ACCESSIBLE"
+	NotAccessible = "NOTACCESSIBLE"
+)
+
+// Transport types of OVAPI.
+const (
+	TransportBus   = "BUS"
+	TransportTram  = "TRAM"
+	TransportMetro = "METRO"
+	TransportBoat  = "BOAT" // the ferries
+)
+
+// TransportOfRouteType returns the transport type of the GTFS route_type t,
+// including the extended ones, or "" when it is none of them.
+func TransportOfRouteType(t int) string {
+	switch {
+	case t == 0, t >= 900 && t < 1000:
+		return TransportTram
+	case t == 1, t >= 400 && t < 500:
+		return TransportMetro
+	case t == 3, t >= 700 && t < 800:
+		return TransportBus
+	case t == 4, t >= 1000 && t < 1100, t == 1200:
+		return TransportBoat
+	}
+	return ""
+}
+
+// Leave returns when to leave to catch the bus.
+func (b Bus) Leave() time.Time {
+	return b.CompiledArrivalTime.Add(-b.WalkTime)
+}
+
+// Reasons a pass is left out.
+const (
+	FilteredLine        = "line"
+	FilteredTransport   = "transport_type"
+	FilteredDirection   = "direction"
+	FilteredStop        = "stop" // another timing point or user stop of the stop area
+	FilteredDestination = "destination"
+	FilteredWheelchair  = "wheelchair" // not known to be wheelchair accessible
+	FilteredPast        = "past"
+	FilteredTooFar      = "too_far"
+	FilteredTooSoon     = "too_soon" // can not be caught within the walk time
+	FilteredParseError  = "parse_error"
+)
+
+// Filter selects the buses of interest. Buses without a transport type, direction, stop or
+// accessibility, like those of the timetable, are not left out for it.
+type Filter struct {
+	Lines     []string // LinePublicNumbers, e.g. 35; all when empty
+	Direction int      // LineDirection, 1 or 2; both when 0
+
+	// TransportTypes are the kinds of vehicles kept, e.g. TRAM; all when empty.
+	TransportTypes []string
+
+	// TimingPoints and UserStops select the side of the road,
+	// e.g. 30001346 and 01346; all of the stop area when empty.
+	TimingPoints []string
+	UserStops    []string
+
+	// Destinations are the DestinationCodes allowed, e.g. OLPP; all when empty.
+	// ExcludeDestinations are left out, e.g. the depot.
+	Destinations        []string
+	ExcludeDestinations []string
+
+	// Wheelchair only keeps vehicles that are wheelchair accessible.
+	Wheelchair bool
+
+	MaxETA   time.Duration // buses arriving later than this are left out
+	WalkTime time.Duration // buses arriving sooner than this are left out
+}
+
+// Drop returns why bus is left out at now, or "" when it is of interest.
+func (f Filter) Drop(bus Bus, now time.Time) string {
+	eta := bus.CompiledArrivalTime.Sub(now)
+
+	switch {
+	case !oneOf(bus.LineNumber, f.Lines):
+		return FilteredLine
+	case bus.TransportType != "" && !oneOf(bus.TransportType, f.TransportTypes):
+		return FilteredTransport
+	case f.Direction != 0 && bus.LineDirection != 0 && bus.LineDirection != f.Direction:
+		return FilteredDirection
+	case bus.TimingPointCode != "" && !oneOf(bus.TimingPointCode, f.TimingPoints),
+		bus.UserStopCode != "" && !oneOf(bus.UserStopCode, f.UserStops):
+		return FilteredStop
+	case !oneOf(bus.FinalDestinationCode, f.Destinations),
+		len(f.ExcludeDestinations) > 0 && oneOf(bus.FinalDestinationCode, f.ExcludeDestinations):
+		return FilteredDestination
+	case f.Wheelchair && bus.WheelchairAccessible != "" && bus.WheelchairAccessible != Accessible:
+		return FilteredWheelchair
+	case eta > f.MaxETA: // Important. This constraints the number of buses to be displayed
+		return FilteredTooFar
+	case eta < 0:
+		return FilteredPast
+	case eta < f.WalkTime:
+		return FilteredTooSoon
+	}
+	return ""
+}
+
+// oneOf reports whether s is in set, or set is empty.
+func oneOf(s string, set []string) bool {
+	for _, v := range set {
+		if s == v {
+			return true
+		}
+	}
+	return len(set) == 0
+}
+
+// Dropped is a pass left out by FromOVAPI.
+type Dropped struct {
+	Line        string
+	Destination string
+	Journey     int
+	Reason      string
+	Arrival     time.Time // zero when the pass could not be parsed
+	Err         error     // why the pass could not be parsed
+}
+
+// FromOVAPI returns the passes of d kept by f at now, ordered by arrival,
+// and the ones it left out.
+func FromOVAPI(d ovapi.Departures, f Filter, now time.Time) ([]Bus, []Dropped) {
+	var (
+		buses   []Bus
+		dropped []Dropped
+	)
+
+	// Process and filter each bus timetable.
+	for _, pass := range d.Passes() {
+		bus, err := fromPass(pass)
+		if err != nil {
+			dropped = append(dropped, Dropped{
+				Line:        pass.LinePublicNumber,
+				Destination: pass.DestinationCode,
+				Journey:     pass.JourneyNumber,
+				Reason:      FilteredParseError,
+				Err:         err,
+			})
+			continue
+		}
+
+		if reason := f.Drop(bus, now); reason != "" {
+			dropped = append(dropped, Dropped{
+				Line:        pass.LinePublicNumber,
+				Destination: pass.DestinationCode,
+				Journey:     pass.JourneyNumber,
+				Reason:      reason,
+				Arrival:     bus.CompiledArrivalTime,
+			})
+			continue
+		}
+		bus.WalkTime = f.WalkTime
+		buses = append(buses, bus)
+	}
+
+	sort.Slice(buses, func(i, j int) bool {
+		return buses[i].CompiledArrivalTime.Before(buses[j].CompiledArrivalTime)
+	})
+	return buses, dropped
+}
+
+func fromPass(pass ovapi.Pass) (Bus, error) {
+	arrivalTime, err := ParsePassTime(pass.ExpectedArrivalTime)
+	if err != nil {
+		return Bus{}, fmt.Errorf("ExpectedArrivalTime: %v", err)
+	}
+
+	// Last update timestamp.
+	lastUpdateTimestamp, err := ParseUpdateTime(pass.LastUpdateTimeStamp)
+	if err != nil {
+		return Bus{}, fmt.Errorf("LastUpdateTimeStamp: %v", err)
+	}
+
+	// Planned time arrival.
+	plannedArrivalTime, err := ParsePassTime(pass.TargetArrivalTime)
+	if err != nil {
+		return Bus{}, fmt.Errorf("TargetArrivalTime: %v", err)
+	}
+
+	return Bus{
+		LineNumber:               pass.LinePublicNumber,
+		TransportType:            pass.TransportType,
+		TripStatus:               pass.TripStopStatus,
+		FinalDestinationName:     pass.DestinationName50,
+		FinalDestinationCode:     pass.DestinationCode,
+		LineDirection:            pass.LineDirection,
+		TimingPointCode:          pass.TimingPointCode,
+		UserStopCode:             pass.UserStopCode,
+		WheelchairAccessible:     pass.WheelChairAccessible,
+		StopWheelchairAccessible: pass.TimingPointWheelChairAccessible,
+		Journey:                  pass.ID,
+		StopOrder:                pass.UserStopOrderNumber,
+		LastUpdateTimestamp:      lastUpdateTimestamp,
+		CompiledArrivalTime:      arrivalTime,
+		PlannedArrivalTime:       plannedArrivalTime,
+		DelaySeconds:             int(arrivalTime.Sub(plannedArrivalTime).Seconds()),
+	}, nil
+}
+
+// amsterdam is the time zone of OVAPI.
+var amsterdam = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}()
+
+// ParsePassTime parses the local times of OVAPI, e.g. 2018-11-17T17:22:16,
+// which are an hour later than UTC in winter and two in summer.
+func ParsePassTime(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02T15:04:05", s, amsterdam)
+}
+
+// ParseUpdateTime parses the LastUpdateTimeStamp of OVAPI, e.g. 2018-11-17T17:22:16+0100
+func ParseUpdateTime(s string) (time.Time, error) {
+	return time.Parse("2006-01-02T15:04:05-0700", s)
+}
@@ -0,0 +1,253 @@
+package arrivals
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+var filter = Filter{Lines: []string{"35"}, Destinations: []string{"OLPP"}, MaxETA: time.Minute * 35}
+
+// fetch gets the fixture in testdata through an OVAPI client.
+func fetch(t *testing.T, fixture string) ovapi.Departures {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join("testdata", fixture))
+	}))
+	defer srv.Close()
+
+	c := ovapi.NewClient(nil)
+	c.URL = srv.URL + "/stopareacode/%s/departures"
+	d, err := c.Departures(context.Background(), "01346")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return d
+}
+
+func reasons(dropped []Dropped) map[string]int {
+	out := map[string]int{}
+	for _, d := range dropped {
+		out[d.Reason]++
+	}
+	return out
+}
+
+func TestFromOVAPI(t *testing.T) {
+	d := fetch(t, "departures.json")
+	now := time.Date(2018, 11, 17, 17, 15, 0, 0, amsterdam)
+
+	buses, dropped := FromOVAPI(d, filter, now)
+	if assert.Len(t, buses, 2) {
+		assert.Equal(t, Bus{
+			LineNumber:           "35",
+			TransportType:        TransportBus,
+			TripStatus:           "DRIVING",
+			FinalDestinationName: "Olof Palmeplein",
+			FinalDestinationCode: "OLPP",
+			LineDirection:        2,
+			TimingPointCode:      "30001346",
+			UserStopCode:         "01346",
+			WheelchairAccessible: Accessible,
+			CompiledArrivalTime:  time.Date(2018, 11, 17, 16, 22, 16, 0, time.UTC),
+			PlannedArrivalTime:   time.Date(2018, 11, 17, 16, 20, 0, 0, time.UTC),
+			LastUpdateTimestamp:  time.Date(2018, 11, 17, 16, 14, 2, 0, time.UTC),
+			DelaySeconds:         136,
+			Journey:              "GVB_20181117_35_1101_0",
+			StopOrder:            21,
+		}, normalize(buses[0]))
+		assert.Equal(t, "PLANNED", buses[1].TripStatus)
+		assert.Equal(t, 0, buses[1].DelaySeconds)
+	}
+
+	assert.Equal(t, map[string]int{
+		FilteredPast:        1,
+		FilteredTooFar:      1,
+		FilteredLine:        1,
+		FilteredDestination: 2,
+	}, reasons(dropped))
+	for _, d := range dropped {
+		if d.Reason == FilteredPast {
+			assert.Equal(t, 1100, d.Journey)
+		}
+	}
+}
+
+// normalize puts the times of bus in UTC, so they compare equal regardless of zone.
+func normalize(bus Bus) Bus {
+	bus.CompiledArrivalTime = bus.CompiledArrivalTime.UTC()
+	bus.PlannedArrivalTime = bus.PlannedArrivalTime.UTC()
+	bus.LastUpdateTimestamp = bus.LastUpdateTimestamp.UTC()
+	return bus
+}
+
+func TestFromOVAPIDirection(t *testing.T) {
+	d := fetch(t, "departures.json")
+	now := time.Date(2018, 11, 17, 17, 15, 0, 0, amsterdam)
+
+	// Every line 35 towards Olof Palmeplein, including the short turn to Slotermeerlaan,
+	// but not the one to the depot.
+	f := Filter{Lines: []string{"35"}, Direction: 2, ExcludeDestinations: []string{"GARA"}, MaxETA: time.Minute * 35}
+	buses, dropped := FromOVAPI(d, f, now)
+	if assert.Len(t, buses, 3) {
+		assert.Equal(t, "SLML", buses[1].FinalDestinationCode)
+		assert.Equal(t, 2, buses[1].LineDirection)
+		assert.Equal(t, "30001346", buses[1].TimingPointCode)
+		assert.Equal(t, "01346", buses[1].UserStopCode)
+	}
+	assert.Equal(t, map[string]int{
+		FilteredPast:      1,
+		FilteredTooFar:    1,
+		FilteredLine:      1,
+		FilteredDirection: 1,
+	}, reasons(dropped))
+
+	// The other side of the road.
+	f = Filter{TimingPoints: []string{"30001345"}, MaxETA: time.Minute * 35}
+	buses, _ = FromOVAPI(d, f, now)
+	if assert.Len(t, buses, 1) {
+		assert.Equal(t, "STZD", buses[0].FinalDestinationCode)
+	}
+	f = Filter{UserStops: []string{"01345"}, MaxETA: time.Minute * 35}
+	buses, _ = FromOVAPI(d, f, now)
+	assert.Len(t, buses, 1)
+}
+
+func TestFromOVAPIMalformed(t *testing.T) {
+	d := fetch(t, "malformed.json")
+	now := time.Date(2018, 11, 17, 17, 15, 0, 0, amsterdam)
+
+	buses, dropped := FromOVAPI(d, filter, now)
+	if assert.Len(t, buses, 1) {
+		assert.True(t, time.Date(2018, 11, 17, 17, 45, 0, 0, amsterdam).Equal(buses[0].CompiledArrivalTime))
+	}
+
+	assert.Equal(t, map[string]int{FilteredParseError: 3}, reasons(dropped))
+	for _, d := range dropped {
+		assert.Error(t, d.Err)
+		assert.True(t, d.Arrival.IsZero())
+	}
+}
+
+func TestFromOVAPIEmpty(t *testing.T) {
+	d := fetch(t, "empty.json")
+
+	buses, dropped := FromOVAPI(d, filter, time.Date(2018, 11, 17, 17, 15, 0, 0, amsterdam))
+	assert.Empty(t, buses)
+	assert.Empty(t, dropped)
+}
+
+func TestFilter(t *testing.T) {
+	at := func(month time.Month, day, h, m int) time.Time {
+		return time.Date(2019, month, day, h, m, 0, 0, amsterdam)
+	}
+	bus := func(line, dest string, arrival time.Time) Bus {
+		return Bus{LineNumber: line, FinalDestinationCode: dest, CompiledArrivalTime: arrival}
+	}
+
+	tests := []struct {
+		name string
+		bus  Bus
+		now  time.Time
+		want string
+	}{
+		{"upcoming", bus("35", "OLPP", at(1, 2, 12, 10)), at(1, 2, 12, 0), ""},
+		{"arriving now", bus("35", "OLPP", at(1, 2, 12, 0)), at(1, 2, 12, 0), ""},
+		{"past", bus("35", "OLPP", at(1, 2, 11, 59)), at(1, 2, 12, 0), FilteredPast},
+		{"at max_eta", bus("35", "OLPP", at(1, 2, 12, 35)), at(1, 2, 12, 0), ""},
+		{"too far", bus("35", "OLPP", at(1, 2, 12, 36)), at(1, 2, 12, 0), FilteredTooFar},
+		{"other line", bus("15", "OLPP", at(1, 2, 12, 10)), at(1, 2, 12, 0), FilteredLine},
+		{"other destination", bus("35", "STZD", at(1, 2, 12, 10)), at(1, 2, 12, 0), FilteredDestination},
+		{"after midnight", bus("35", "OLPP", at(1, 3, 0, 5)), at(1, 2, 23, 55), ""},
+		{"before midnight", bus("35", "OLPP", at(1, 2, 23, 55)), at(1, 3, 0, 5), FilteredPast},
+		// 02:00 to 03:00 is skipped, so 03:30 is 40 minutes after 01:50.
+		{"clocks forward", bus("35", "OLPP", at(3, 31, 3, 30)), at(3, 31, 1, 50), FilteredTooFar},
+		{"clocks back", bus("35", "OLPP", time.Date(2019, 10, 27, 1, 10, 0, 0, time.UTC)), time.Date(2019, 10, 27, 0, 50, 0, 0, time.UTC), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, filter.Drop(tt.bus, tt.now))
+		})
+	}
+
+	walk := filter
+	walk.WalkTime = time.Minute * 5
+	assert.Equal(t, FilteredTooSoon, walk.Drop(bus("35", "OLPP", at(1, 2, 12, 4)), at(1, 2, 12, 0)))
+	assert.Equal(t, "", walk.Drop(bus("35", "OLPP", at(1, 2, 12, 5)), at(1, 2, 12, 0)))
+
+	deny := filter
+	deny.Destinations = nil
+	deny.ExcludeDestinations = []string{"GARA"}
+	assert.Equal(t, FilteredDestination, deny.Drop(bus("35", "GARA", at(1, 2, 12, 10)), at(1, 2, 12, 0)))
+	assert.Equal(t, "", deny.Drop(bus("35", "SLML", at(1, 2, 12, 10)), at(1, 2, 12, 0)))
+
+	// Directions and stops are only checked when known, as the timetable has neither.
+	dir := Filter{Direction: 2, TimingPoints: []string{"30001346"}, MaxETA: time.Minute * 35}
+	b := bus("35", "STZD", at(1, 2, 12, 10))
+	assert.Equal(t, "", dir.Drop(b, at(1, 2, 12, 0)))
+	b.LineDirection = 1
+	assert.Equal(t, FilteredDirection, dir.Drop(b, at(1, 2, 12, 0)))
+	b.LineDirection, b.TimingPointCode = 2, "30001345"
+	assert.Equal(t, FilteredStop, dir.Drop(b, at(1, 2, 12, 0)))
+
+	// Only vehicles known to be accessible, or without accessibility like those of the timetable.
+	wheelchair := Filter{Wheelchair: true, MaxETA: time.Minute * 35}
+	for access, want := range map[string]string{
+		Accessible:    "",
+		NotAccessible: FilteredWheelchair,
+		"UNKNOWN":     FilteredWheelchair,
+		"":            "",
+	} {
+		b := bus("35", "OLPP", at(1, 2, 12, 10))
+		b.WheelchairAccessible = access
+		assert.Equal(t, want, wheelchair.Drop(b, at(1, 2, 12, 0)), access)
+	}
+
+	// Likewise for the transport type.
+	trams := Filter{TransportTypes: []string{TransportTram, TransportMetro}, MaxETA: time.Minute * 35}
+	for transport, want := range map[string]string{
+		TransportTram: "",
+		TransportBus:  FilteredTransport,
+		"":            "",
+	} {
+		b := bus("5", "AMVE", at(1, 2, 12, 10))
+		b.TransportType = transport
+		assert.Equal(t, want, trams.Drop(b, at(1, 2, 12, 0)), transport)
+	}
+
+	any := Filter{MaxETA: time.Minute * 35}
+	assert.Equal(t, "", any.Drop(bus("15", "STZD", at(1, 2, 12, 10)), at(1, 2, 12, 0)))
+}
+
+func TestTransportOfRouteType(t *testing.T) {
+	assert.Equal(t, TransportTram, TransportOfRouteType(0))
+	assert.Equal(t, TransportMetro, TransportOfRouteType(1))
+	assert.Equal(t, TransportBus, TransportOfRouteType(3))
+	assert.Equal(t, TransportBoat, TransportOfRouteType(4))
+	assert.Equal(t, TransportBus, TransportOfRouteType(700))
+	assert.Equal(t, TransportBoat, TransportOfRouteType(1200))
+	assert.Equal(t, "", TransportOfRouteType(2)) // rail
+	assert.Equal(t, "", TransportOfRouteType(-1))
+}
+
+func TestParsePassTime(t *testing.T) {
+	winter, err := ParsePassTime("2018-11-17T17:22:16")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 11, 17, 16, 22, 16, 0, time.UTC), winter.UTC())
+
+	summer, err := ParsePassTime("2019-07-01T12:10:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 7, 1, 10, 10, 0, 0, time.UTC), summer.UTC())
+
+	updated, err := ParseUpdateTime("2019-07-01T11:59:00+0200")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 7, 1, 9, 59, 0, 0, time.UTC), updated.UTC())
+
+	_, err = ParsePassTime("17:22:16")
+	assert.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package brightness
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+)
+
+// Setter is anything with an adjustable brightness, like unicorn.Client.
+type Setter interface {
+	SetBrightness(v uint) error
+}
+
+// Controller adjusts the brightness of the display over the day.
+// A light sensor wins over the configured curve, which wins over
+// the sunrise and sunset at the location of the stop.
+type Controller struct {
+	clock clock.Clock
+	log   *logger.Logger
+
+	mu       sync.Mutex
+	cfg      config.Brightness
+	lat, lon float64
+	located  bool
+	current  uint
+	started  bool
+
+	held      bool
+	heldLevel uint
+	heldUntil time.Time
+}
+
+// New returns a brightness Controller running on clk, logging to log, which may be nil.
+func New(cfg config.Brightness, clk clock.Clock, log *logger.Logger) *Controller {
+	return &Controller{
+		cfg:   cfg,
+		clock: clk,
+		log:   log.With("component", "brightness"),
+	}
+}
+
+// SetConfig applies a reloaded config. The brightness moves towards the new
+// target a Step at a time, like it does over the day.
+func (c *Controller) SetConfig(cfg config.Brightness) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cfg = cfg
+}
+
+// SetLocation sets the location used for sunrise and sunset,
+// e.g. the Latitude and Longitude of the stop.
+func (c *Controller) SetLocation(lat, lon float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lat, c.lon = lat, lon
+	c.located = true
+}
+
+// Hold fixes the brightness at v for d, or until Release when d is 0.
+// The next Update jumps straight to v.
+func (c *Controller) Hold(v uint, d time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = true
+	c.heldLevel = v
+	c.heldUntil = time.Time{}
+	if d > 0 {
+		c.heldUntil = now.Add(d)
+	}
+	c.started = false
+}
+
+// Release returns to automatic brightness after a Hold.
+func (c *Controller) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = false
+}
+
+// Held returns the level set by Hold and whether it is still in effect at now.
+func (c *Controller) Held(now time.Time) (uint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.held || (!c.heldUntil.IsZero() && now.After(c.heldUntil)) {
+		return 0, false
+	}
+	return c.heldLevel, true
+}
+
+// Run keeps the brightness of d in line with Target until ctx is done.
+func (c *Controller) Run(ctx context.Context, d Setter) {
+	for {
+		if err := c.Update(d, c.clock.Now()); err != nil {
+			c.log.Warn("could not set brightness", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(c.interval()):
+		}
+	}
+}
+
+// interval returns how often Run updates the brightness.
+func (c *Controller) interval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cfg.Interval.Duration
+}
+
+// Update moves the brightness of d one Step towards the Target at now.
+// The first call jumps straight to the target.
+func (c *Controller) Update(d Setter, now time.Time) error {
+	target := c.Target(now)
+
+	c.mu.Lock()
+	next := target
+	if c.started {
+		next = approach(c.current, target, c.cfg.Step)
+	}
+	unchanged := c.started && next == c.current
+	c.mu.Unlock()
+
+	if unchanged {
+		return nil
+	}
+	if err := d.SetBrightness(next); err != nil {
+		return err
+	}
+	c.log.Debug("brightness changed", "level", next, "target", target)
+
+	c.mu.Lock()
+	c.current = next
+	c.started = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Target returns the brightness the display should have at now.
+func (c *Controller) Target(now time.Time) uint {
+	if v, ok := c.Held(now); ok {
+		return v
+	}
+
+	c.mu.Lock()
+	cfg, lat, lon, located := c.cfg, c.lat, c.lon, c.located
+	c.mu.Unlock()
+
+	if cfg.Sensor != "" {
+		v, err := readSensor(cfg.Sensor)
+		if err == nil {
+			return scale(cfg.Night, cfg.Day, v/float64(cfg.SensorMax))
+		}
+		c.log.Warn("could not read light sensor", "sensor", cfg.Sensor, "err", err)
+	}
+
+	if len(cfg.Curve) > 0 {
+		return curve(cfg.Curve, config.Of(now))
+	}
+
+	if !located {
+		return cfg.Day
+	}
+
+	rise, set, ok := Sun(now, lat, lon)
+	if !ok {
+		// Polar day or night, decided by the season.
+		if _, m, _ := now.Date(); (m > 3 && m < 10) == (lat > 0) {
+			return cfg.Day
+		}
+		return cfg.Night
+	}
+
+	// Fade in around sunrise and out around sunset.
+	tw := cfg.Twilight.Duration
+	if tw <= 0 {
+		tw = time.Minute
+	}
+	switch {
+	case now.Before(rise.Add(-tw/2)) || now.After(set.Add(tw/2)):
+		return cfg.Night
+	case now.Before(rise.Add(tw / 2)):
+		return scale(cfg.Night, cfg.Day, float64(now.Sub(rise.Add(-tw/2)))/float64(tw))
+	case now.After(set.Add(-tw / 2)):
+		return scale(cfg.Day, cfg.Night, float64(now.Sub(set.Add(-tw/2)))/float64(tw))
+	default:
+		return cfg.Day
+	}
+}
+
+// curve interpolates linearly between the points around now,
+// wrapping around midnight.
+func curve(points []config.CurvePoint, now config.Clock) uint {
+	const day = config.Clock(time.Hour * 24)
+
+	var prev, next config.CurvePoint
+	prevDist, nextDist := day, day
+	for _, p := range points {
+		before := (now - p.At + day) % day
+		after := (p.At - now + day) % day
+		if before < prevDist {
+			prev, prevDist = p, before
+		}
+		if after < nextDist {
+			next, nextDist = p, after
+		}
+	}
+
+	if prevDist+nextDist == 0 {
+		return prev.Level
+	}
+	return scale(prev.Level, next.Level, float64(prevDist)/float64(prevDist+nextDist))
+}
+
+// scale returns the value at f (0..1) on the way from a to b.
+func scale(a, b uint, f float64) uint {
+	if f < 0 {
+		f = 0
+	}
+	if f > 1 {
+		f = 1
+	}
+	return uint(float64(a) + (float64(b)-float64(a))*f + 0.5)
+}
+
+// approach moves from cur towards target by at most step.
+func approach(cur, target, step uint) uint {
+	switch {
+	case step == 0:
+		return target
+	case target > cur+step:
+		return cur + step
+	case target+step < cur:
+		return cur - step
+	default:
+		return target
+	}
+}
+
+func readSensor(path string) (float64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+}
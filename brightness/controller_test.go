@@ -0,0 +1,197 @@
+package brightness
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+// levels records the brightness set, failing when err is set.
+type levels struct {
+	set []uint
+	err error
+}
+
+func (l *levels) SetBrightness(v uint) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.set = append(l.set, v)
+	return nil
+}
+
+func TestCurveMidnight(t *testing.T) {
+	points := []config.CurvePoint{{At: clockAt(t, "07:00"), Level: 200}, {At: clockAt(t, "22:00"), Level: 10}}
+
+	tests := []struct {
+		at   config.Clock
+		want uint
+	}{
+		{clockAt(t, "07:00"), 200},
+		{clockAt(t, "14:30"), 105}, // halfway through the day
+		{clockAt(t, "22:00"), 10},
+		{clockAt(t, "23:00"), 31}, // a ninth into the night
+		{clockAt(t, "00:00"), 52},
+		{clockAt(t, "02:30"), 105}, // halfway through the night, past midnight
+		{clockAt(t, "06:00"), 179},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, curve(points, tt.at), "at %v", time.Duration(tt.at))
+	}
+
+	assert.Equal(t, uint(80), curve([]config.CurvePoint{{At: clockAt(t, "12:00"), Level: 80}}, clockAt(t, "03:00")), "one point all day")
+}
+
+func TestTargetTwilight(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	assert.NoError(t, err)
+	day := time.Date(2018, 6, 21, 0, 0, 0, 0, loc)
+	rise, set, _ := Sun(day, 52.37, 4.90)
+
+	cfg := config.Default().Brightness
+	cfg.Day, cfg.Night, cfg.Twilight.Duration = 200, 20, time.Minute*30
+	c := New(cfg, clock.NewFake(day), nil)
+	assert.Equal(t, uint(200), c.Target(day), "day until located")
+	c.SetLocation(52.37, 4.90)
+
+	tests := []struct {
+		at   time.Time
+		want uint
+	}{
+		{day, 20},
+		{rise.Add(-time.Minute * 16), 20},
+		{rise.Add(-time.Minute * 15), 20},
+		{rise.Add(-time.Minute * 5), 80},
+		{rise, 110},
+		{rise.Add(time.Minute * 15), 200},
+		{day.Add(time.Hour * 13), 200},
+		{set.Add(-time.Minute * 15), 200},
+		{set, 110},
+		{set.Add(time.Minute * 5), 80},
+		{set.Add(time.Minute * 16), 20},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, c.Target(tt.at), "at %v", tt.at.Format("15:04:05"))
+	}
+}
+
+func TestApproach(t *testing.T) {
+	tests := []struct {
+		cur, target, step, want uint
+	}{
+		{100, 200, 10, 110},
+		{100, 105, 10, 105},
+		{200, 100, 10, 190},
+		{105, 100, 10, 100},
+		{5, 0, 10, 0},
+		{250, 255, 10, 255},
+		{100, 200, 0, 200}, // no step jumps
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, approach(tt.cur, tt.target, tt.step), "%v to %v by %v", tt.cur, tt.target, tt.step)
+	}
+}
+
+func TestUpdateSteps(t *testing.T) {
+	now := time.Date(2018, 6, 21, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default().Brightness
+	cfg.Day, cfg.Step = 200, 30
+	c := New(cfg, clock.NewFake(now), nil)
+
+	var d levels
+	assert.NoError(t, c.Update(&d, now), "the first jumps")
+	cfg.Day = 100
+	c.SetConfig(cfg)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, c.Update(&d, now))
+	}
+	assert.Equal(t, []uint{200, 170, 140, 110, 100}, d.set, "unchanged levels are not sent again")
+
+	d.err = errors.New("gone")
+	c.Hold(50, 0, now)
+	assert.Error(t, c.Update(&d, now))
+	d.err = nil
+	assert.NoError(t, c.Update(&d, now))
+	assert.Equal(t, uint(50), d.set[len(d.set)-1], "a hold jumps, also after a failed update")
+}
+
+func TestTargetSensor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brightness")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sensor := filepath.Join(dir, "in_illuminance_input")
+
+	now := time.Date(2018, 6, 21, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default().Brightness
+	cfg.Day, cfg.Night = 200, 20
+	cfg.Sensor, cfg.SensorMax = sensor, 1000
+	cfg.Curve = []config.CurvePoint{{At: clockAt(t, "00:00"), Level: 60}}
+
+	tests := []struct {
+		name  string
+		value string // "" when there is no sensor file
+		want  uint
+	}{
+		{"dark", "0", 20},
+		{"half", "500\n", 110},
+		{"bright", "1000", 200},
+		{"brighter than max", "2500", 200},
+		{"missing", "", 60},
+		{"garbage", "lots", 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(sensor)
+			if tt.value != "" {
+				assert.NoError(t, ioutil.WriteFile(sensor, []byte(tt.value), 0644))
+			}
+			c := New(cfg, clock.NewFake(now), nil)
+			assert.Equal(t, tt.want, c.Target(now))
+		})
+	}
+}
+
+func TestHold(t *testing.T) {
+	now := time.Date(2018, 6, 21, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default().Brightness
+	cfg.Day = 200
+
+	tests := []struct {
+		name    string
+		d       time.Duration // of the hold
+		release bool
+		at      time.Duration // after the hold
+		want    uint
+		held    bool
+	}{
+		{"held", time.Hour, false, time.Minute * 59, 40, true},
+		{"until the end", time.Hour, false, time.Hour, 40, true},
+		{"expired", time.Hour, false, time.Hour + time.Second, 200, false},
+		{"released", time.Hour, true, time.Minute, 200, false},
+		{"until released", 0, false, time.Hour * 24 * 7, 40, true},
+		{"released without end", 0, true, 0, 200, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(cfg, clock.NewFake(now), nil)
+			c.Hold(40, tt.d, now)
+			if tt.release {
+				c.Release()
+			}
+
+			assert.Equal(t, tt.want, c.Target(now.Add(tt.at)))
+			v, ok := c.Held(now.Add(tt.at))
+			assert.Equal(t, tt.held, ok)
+			if ok {
+				assert.Equal(t, uint(40), v)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package brightness
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	julianUnixEpoch = 2440587.5 // julian date of 1970-01-01 00:00 UTC
+	julian2000      = 2451545.0 // julian date of 2000-01-01 12:00 UTC
+)
+
+// Sun returns the sunrise and sunset on the day of t at the given location,
+// using the sunrise equation. ok is false during polar day or night.
+// See https://en.wikipedia.org/wiki/Sunrise_equation
+func Sun(t time.Time, lat, lon float64) (rise, set time.Time, ok bool) {
+	y, m, d := t.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, t.Location())
+
+	// Mean solar time.
+	jd := float64(noon.Unix())/86400 + julianUnixEpoch
+	n := math.Floor(jd - julian2000 + 0.0008 + 0.5)
+	j := n - lon/360
+
+	// Solar mean anomaly, equation of the center and ecliptic longitude.
+	ma := math.Mod(357.5291+0.98560028*j, 360)
+	c := 1.9148*sin(ma) + 0.02*sin(2*ma) + 0.0003*sin(3*ma)
+	l := math.Mod(ma+c+180+102.9372, 360)
+
+	transit := julian2000 + j + 0.0053*sin(ma) - 0.0069*sin(2*l)
+
+	// Declination of the sun and the hour angle.
+	decl := math.Asin(sin(l) * sin(23.4397))
+	cosw := (sin(-0.833) - sin(lat)*math.Sin(decl)) / (cos(lat) * math.Cos(decl))
+	if cosw < -1 || cosw > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	w := math.Acos(cosw) * 180 / math.Pi
+
+	return fromJulian(transit-w/360, t.Location()), fromJulian(transit+w/360, t.Location()), true
+}
+
+func fromJulian(j float64, loc *time.Location) time.Time {
+	secs := (j - julianUnixEpoch) * 86400
+	return time.Unix(int64(secs), 0).In(loc)
+}
+
+func sin(deg float64) float64 {
+	return math.Sin(deg * math.Pi / 180)
+}
+
+func cos(deg float64) float64 {
+	return math.Cos(deg * math.Pi / 180)
+}
@@ -0,0 +1,55 @@
+package brightness
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+func TestSun(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		day       time.Time
+		rise, set string
+	}{
+		{time.Date(2018, 6, 21, 9, 0, 0, 0, loc), "05:18", "22:06"},
+		{time.Date(2018, 12, 21, 23, 0, 0, 0, loc), "08:48", "16:29"},
+	}
+
+	for _, c := range cases {
+		rise, set, ok := Sun(c.day, 52.37, 4.90)
+		assert.True(t, ok)
+		assert.InDelta(t, 0, rise.Sub(at(t, c.day, c.rise)).Minutes(), 3, "sunrise on %v: %v", c.day, rise)
+		assert.InDelta(t, 0, set.Sub(at(t, c.day, c.set)).Minutes(), 3, "sunset on %v: %v", c.day, set)
+	}
+
+	_, _, ok := Sun(time.Date(2018, 6, 21, 12, 0, 0, 0, time.UTC), 80, 0)
+	assert.False(t, ok)
+}
+
+func TestCurve(t *testing.T) {
+	points := []config.CurvePoint{
+		{At: clockAt(t, "07:00"), Level: 40},
+		{At: clockAt(t, "22:00"), Level: 10},
+	}
+
+	assert.Equal(t, uint(40), curve(points, clockAt(t, "07:00")))
+	assert.Equal(t, uint(25), curve(points, clockAt(t, "14:30")))
+	assert.Equal(t, uint(25), curve(points, clockAt(t, "02:30")))
+}
+
+func at(t *testing.T, day time.Time, hhmm string) time.Time {
+	c := clockAt(t, hhmm)
+	y, m, d := day.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, day.Location()).Add(time.Duration(c))
+}
+
+func clockAt(t *testing.T, hhmm string) config.Clock {
+	var c config.Clock
+	assert.NoError(t, c.UnmarshalJSON([]byte(`"`+hhmm+`"`)))
+	return c
+}
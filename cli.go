@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/brightness"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/gtfs"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %v [-config config.json] [command] [flags]
+
+Commands:
+  run            show the upcoming buses on the display, the default
+  once           print the upcoming buses once, as a table or -json
+  list-lines     print the lines passing the stop areas of the watches, or the ones passed
+  stops          find stop areas by name or town, or -near a location
+  simulate       show made-up buses on this terminal
+  test-display   cycle colours, digits and brightness to check the wiring
+  report         show how punctual the buses in the history were
+  evaluate       show whether the correction learned from the history helps
+
+Run a command with -h for its flags.
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// once prints the upcoming buses of the watches as a table, or as JSON
+// like /arrivals, falling back on the timetable when OVAPI cannot be reached.
+// It returns the exit code.
+func once(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("once", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	log := logger.New(os.Stderr, cfg.Log.Format, logger.Warn)
+	oc := ovapi.NewClient(log)
+	oc.Every = cfg.RequestInterval.Duration
+	p := &poller{cfg: cfg, clock: clock.Real, oc: oc}
+
+	buses, _, err := p.pull(context.Background())
+	if err != nil && cfg.Schedule.GTFS != "" {
+		log.Warn("could not fetch departures, showing the schedule", "err", err)
+		if p.tt, err = gtfs.Load(cfg.Schedule.GTFS, cfg.Schedule.StopCode); err == nil {
+			buses = p.scheduled(clock.Real.Now())
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	now := clock.Real.Now()
+	if *asJSON {
+		out := []arrival{}
+		for _, bus := range buses {
+			out = append(out, arrival{
+				Bus:        bus,
+				ETASeconds: int(bus.CompiledArrivalTime.Sub(now).Seconds()),
+			})
+		}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(b))
+		return 0
+	}
+
+	if len(buses) == 0 {
+		fmt.Println("no buses within", cfg.MaxETA.Duration)
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WATCH\tTYPE\tLINE\tDESTINATION\tARRIVAL\tETA\tLEAVE IN\tDELAY\tAWAY\tWHEELCHAIR\tSTATUS")
+	for _, bus := range buses {
+		status := bus.TripStatus
+		if bus.Corrected {
+			status += " (corrected)"
+		}
+		away := ""
+		if a := bus.Approach; a != nil {
+			away = fmt.Sprintf("%d stops, %.1f km", a.Stops, a.Meters/1000)
+		}
+		wheelchair := ""
+		switch bus.WheelchairAccessible {
+		case arrivals.Accessible:
+			wheelchair = "yes"
+		case arrivals.NotAccessible:
+			wheelchair = "no"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			bus.Watch,
+			strings.ToLower(bus.TransportType),
+			bus.LineNumber,
+			bus.FinalDestinationName,
+			bus.CompiledArrivalTime.Format("15:04:05"),
+			bus.CompiledArrivalTime.Sub(now).Round(time.Second),
+			bus.Leave().Sub(now).Round(time.Second),
+			time.Duration(bus.DelaySeconds)*time.Second,
+			away,
+			wheelchair,
+			status,
+		)
+	}
+	w.Flush()
+	return 0
+}
+
+// listLines prints the lines passing the stop areas passed, or those of the
+// watches, with their directions and destinations. It returns the exit code.
+func listLines(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("list-lines", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	codes := fs.Args()
+	if len(codes) == 0 {
+		codes = stopAreas(cfg.Watchlist())
+	}
+
+	ctx := context.Background()
+	oc := ovapi.NewClient(nil)
+	oc.Every = cfg.RequestInterval.Duration
+
+	failed := false
+	for _, code := range codes {
+		d, err := oc.Departures(ctx, code)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stop area %v: %v\n", code, err)
+			failed = true
+			continue
+		}
+
+		if stop, ok := d.Stop(); ok {
+			fmt.Printf("%v  %v, %v\n", code, stop.TimingPointName, stop.TimingPointTown)
+		} else {
+			fmt.Println(code)
+		}
+		served := servedBy(d)
+		if len(served) == 0 {
+			fmt.Printf("  no departures right now\n\n")
+			continue
+		}
+		for _, s := range served {
+			fmt.Printf("  %v  %v direction %d to %v\n", s.timingPoint, s.line, s.direction, strings.Join(s.destinations, ", "))
+		}
+		fmt.Println()
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// simulate shows made-up buses of every watch on this terminal, on a clock
+// running -speed times as fast, e.g. to try a config without a Pi.
+// It returns the exit code.
+func simulate(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	speed := fs.Float64("speed", 1, "how many times faster than real time to run")
+	runFor := fs.Duration("for", 0, "stop after this long on the simulated clock, 0 runs until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log := logger.New(os.Stderr, cfg.Log.Format, logger.Warn)
+	begin := time.Now()
+	clk := clock.NewVirtual(begin, *speed)
+	d, err := openDisplay(true, cfg, log)
+	if err != nil {
+		log.Error("could not open display", "err", err)
+		return 1
+	}
+	defer closeDisplay(d, log)
+
+	// Made-up buses are always there, so only quiet hours would blank the display.
+	cfg.Sleep = config.Sleep{WakeFor: cfg.Sleep.WakeFor}
+
+	in := make(chan []arrivals.Bus)
+	sch := &scheduler{
+		c:     d,
+		cfg:   cfg,
+		sl:    newSleeper(cfg.Sleep, clk, log),
+		in:    in,
+		log:   log.With("component", "scheduler"),
+		clock: clk,
+	}
+	defer start(sch.run)()
+
+	var done <-chan time.Time
+	if *runFor > 0 {
+		done = clk.After(*runFor)
+	}
+	for {
+		select {
+		case in <- fakeBuses(cfg, begin, clk.Now()):
+		case <-ctx.Done():
+			return 0
+		}
+
+		select {
+		case <-clk.After(cfg.PollInterval.Duration):
+		case <-done:
+			return 0
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
+
+// fakeBuses returns made-up buses of every watch arriving within max_eta of now.
+// The buses of the i-th watch come every 6+2i minutes from 2i+1 minutes after
+// start, every third one is two minutes late and every other one is wheelchair
+// accessible. The watches take turns being a bus, tram, metro and ferry, unless
+// they are limited to a transport type. With stops_away the first
+// bus of each watch is a stop away for every two minutes it still has to go.
+func fakeBuses(cfg config.Config, start, now time.Time) []arrivals.Bus {
+	wheelchair := []string{arrivals.Accessible, arrivals.NotAccessible}
+	transports := []string{arrivals.TransportBus, arrivals.TransportTram, arrivals.TransportMetro, arrivals.TransportBoat}
+	var buses []arrivals.Bus
+	for i, w := range cfg.Watchlist() {
+		line := fmt.Sprint(i + 1)
+		if len(w.Lines) > 0 {
+			line = w.Lines[0]
+		}
+		dest := "SIM"
+		if len(w.Destinations) > 0 {
+			dest = w.Destinations[0]
+		}
+		transport := transports[i%len(transports)]
+		if len(w.TransportTypes) > 0 {
+			transport = w.TransportTypes[0]
+		}
+
+		headway := time.Minute * time.Duration(6+2*i)
+		first := start.Add(time.Minute * time.Duration(2*i+1))
+		next := len(buses) // the first bus of the watch
+		k := 0
+		if now.After(first) {
+			k = int(now.Sub(first)/headway) + 1
+		}
+		for ; ; k++ {
+			planned := first.Add(headway * time.Duration(k))
+			if planned.Sub(now) > cfg.MaxETA.Duration {
+				break
+			}
+			var delay time.Duration
+			if k%3 == 2 {
+				delay = time.Minute * 2
+			}
+			var approach *arrivals.Approach
+			if cfg.StopsAway && len(buses) == next {
+				approach = &arrivals.Approach{Stops: int(planned.Add(delay).Sub(now).Minutes()) / 2}
+			}
+			buses = append(buses, arrivals.Bus{
+				LineNumber:           line,
+				TransportType:        transport,
+				TripStatus:           "DRIVING",
+				FinalDestinationName: "Simulated",
+				FinalDestinationCode: dest,
+				CompiledArrivalTime:  planned.Add(delay),
+				PlannedArrivalTime:   planned,
+				DelaySeconds:         int(delay.Seconds()),
+				Watch:                w.Name,
+				WalkTime:             w.WalkTime.Duration,
+				Approach:             approach,
+				WheelchairAccessible: wheelchair[k%2],
+			})
+		}
+	}
+	return buses
+}
+
+// testDisplay cycles full colours, every ETA, the brightness and scrolling
+// text, to check the display is wired and mounted the right way round.
+// It returns the exit code.
+func testDisplay(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("test-display", flag.ContinueOnError)
+	emulate := fs.Bool("emulate", false, "draw on this terminal instead of the unicornd display")
+	step := fs.Duration("step", time.Second, "how long each colour and digit is shown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	level, _ := logger.ParseLevel(cfg.Log.Level) // checked by config.Validate
+	log := logger.New(os.Stderr, cfg.Log.Format, level)
+	d, err := openDisplay(*emulate, cfg, log)
+	if err != nil {
+		log.Error("could not open display", "err", err)
+		return 1
+	}
+	defer closeDisplay(d, log)
+
+	pause := func(t time.Duration) bool {
+		select {
+		case <-time.After(t):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	showCanvas := func(cv *unicorn.Canvas, t time.Duration) bool {
+		if err := d.SetCanvas(cv); err != nil {
+			log.Warn("could not set pixels", "err", err)
+		}
+		d.Show()
+		return pause(t)
+	}
+	show := func(m unicorn.Matrix, t time.Duration) bool {
+		cv := newCanvas()
+		cv.DrawMatrix(m, 0, 0)
+		return showCanvas(cv, t)
+	}
+	fill := func(p unicorn.Pixel) *unicorn.Canvas {
+		cv := newCanvas()
+		for x := 0; x < cv.Width; x++ {
+			for y := 0; y < cv.Height; y++ {
+				cv.Set(x, y, p)
+			}
+		}
+		return cv
+	}
+
+	d.SetBrightness(255)
+	log.Info("showing colours")
+	for _, p := range []unicorn.Pixel{{R: 255}, {G: 255}, {B: 255}, {R: 255, G: 255, B: 255}} {
+		if !showCanvas(fill(p), *step) {
+			return 0
+		}
+	}
+
+	log.Info("showing ETAs")
+	for _, min := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 100} {
+		if !show(render(eta{min: min, leave: min}), *step) {
+			return 0
+		}
+	}
+
+	log.Info("showing icons")
+	for _, transport := range []string{arrivals.TransportBus, arrivals.TransportTram, arrivals.TransportMetro, arrivals.TransportBoat} {
+		m, _ := renderIcon(transport)
+		if !show(m, *step) {
+			return 0
+		}
+	}
+
+	log.Info("playing the boot animation")
+	boot, begin := bootSprite(cfg, log), time.Now()
+	for {
+		cv := newCanvas()
+		if !boot.Draw(cv, time.Since(begin), 0, 0) || !showCanvas(cv, frameInterval/2) {
+			break
+		}
+		if boot.Loops == 0 && time.Since(begin) > boot.Length() {
+			break // once is enough
+		}
+	}
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	log.Info("ramping brightness")
+	d.SetCanvas(fill(unicorn.Pixel{R: 255, G: 255, B: 255}))
+	for v := 0; v <= 255; v += 15 {
+		d.SetBrightness(uint(v))
+		d.Show()
+		if !pause(*step / 8) {
+			return 0
+		}
+	}
+	if err := brightness.New(cfg.Brightness, clock.Real, log).Update(d, time.Now()); err != nil {
+		log.Warn("could not set brightness", "err", err)
+	}
+
+	log.Info("scrolling text")
+	var sc scroller
+	segs := []segment{
+		{glyph: warningSign, color: alertColor},
+		{text: " 0123456789 ", color: etaColor(9)},
+		{text: "ok", color: etaColor(3)},
+	}
+	for sc.passes == 0 {
+		if !showCanvas(sc.step("test", segs, displayWidth), frameInterval) {
+			return 0
+		}
+	}
+
+	log.Info("display test done")
+	return 0
+}
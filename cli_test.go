@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+func TestFakeBuses(t *testing.T) {
+	start := time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default()
+	cfg.MaxETA = config.Duration{Duration: time.Minute * 20}
+	cfg.Watches = []config.Watch{
+		{Name: "bus", StopAreaCode: "01346", Lines: []string{"35"}},
+		{Name: "tram", StopAreaCode: "08174"},
+	}
+
+	// 10 minutes in: the bus every 6 minutes from 12:01, the tram every 8 from 12:03.
+	buses := fakeBuses(cfg, start, start.Add(time.Minute*10))
+	var got []string
+	for _, bus := range buses {
+		got = append(got, bus.Watch+" "+bus.LineNumber+" "+bus.CompiledArrivalTime.Format("15:04"))
+	}
+	assert.Equal(t, []string{
+		"bus 35 12:15", // planned 12:13, late
+		"bus 35 12:19",
+		"bus 35 12:25",
+		"tram 2 12:11",
+		"tram 2 12:21", // planned 12:19, late
+		"tram 2 12:27",
+	}, got)
+	assert.Equal(t, arrivals.TransportBus, buses[0].TransportType)
+	assert.Equal(t, arrivals.TransportTram, buses[3].TransportType)
+	for _, bus := range buses {
+		assert.False(t, bus.PlannedArrivalTime.Before(start.Add(time.Minute*10)))
+	}
+}
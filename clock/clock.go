@@ -0,0 +1,113 @@
+// Package clock lets time be read and waited on through an interface,
+// so it can run at a different speed when replaying captured data,
+// or stand still at a chosen instant in tests.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the wall clock.
+var Real Clock = wall{}
+
+type wall struct{}
+
+func (wall) Now() time.Time                         { return time.Now() }
+func (wall) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Virtual is a clock that starts at a given time and runs at a multiple of real time.
+type Virtual struct {
+	start  time.Time
+	origin time.Time
+	speed  float64
+}
+
+// NewVirtual returns a clock that reads start now and runs speed times as fast as real time.
+func NewVirtual(start time.Time, speed float64) *Virtual {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &Virtual{start: start, origin: time.Now(), speed: speed}
+}
+
+// Now returns the virtual time.
+func (v *Virtual) Now() time.Time {
+	return v.start.Add(time.Duration(float64(time.Since(v.origin)) * v.speed))
+}
+
+// After waits for d of virtual time and then sends the virtual time.
+func (v *Virtual) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(time.Duration(float64(d)/v.speed), func() {
+		ch <- v.Now()
+	})
+	return ch
+}
+
+// Fake is a clock that only moves when told to, for tests.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFake returns a clock standing still at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After sends the fake time once the clock is moved d ahead.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock d ahead, firing the After channels that are due.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the After channels that are due.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+	waiting := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(t) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- t
+	}
+	f.waiters = waiting
+}
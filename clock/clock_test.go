@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2019, 3, 31, 1, 59, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	soon, later := f.After(time.Minute), f.After(time.Hour)
+	f.Advance(time.Second * 59)
+	assert.Len(t, soon, 0)
+
+	f.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-soon)
+	assert.Len(t, later, 0)
+
+	f.Set(start.Add(time.Hour * 2))
+	assert.Equal(t, start.Add(time.Hour*2), <-later)
+	assert.Equal(t, start.Add(time.Hour*2), f.Now())
+
+	assert.Equal(t, f.Now(), <-f.After(0))
+}
+
+func TestVirtual(t *testing.T) {
+	start := time.Date(2019, 1, 2, 8, 0, 0, 0, time.UTC)
+	v := NewVirtual(start, 3600)
+
+	at := <-v.After(time.Minute * 30) // half a second
+	assert.False(t, at.Before(start.Add(time.Minute*30)))
+	assert.True(t, v.Now().Before(start.Add(time.Hour)))
+}
@@ -0,0 +1,492 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/logger"
+)
+
+// Display modes.
+const (
+	ModeCycle    = "cycle"     // one bus at a time
+	ModeMultiBus = "multi-bus" // all buses scrolling by
+	ModeClock    = "clock"     // the time of day
+)
+
+// Modes lists all display modes.
+var Modes = []string{ModeCycle, ModeMultiBus, ModeClock}
+
+// ValidMode reports whether m is one of Modes.
+func ValidMode(m string) bool {
+	return oneOf(m, Modes)
+}
+
+// oneOf reports whether s is in set.
+func oneOf(s string, set []string) bool {
+	for _, v := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// TransportTypes lists the kinds of vehicles of OVAPI a watch can be limited to.
+var TransportTypes = []string{"BUS", "TRAM", "METRO", "BOAT"}
+
+// Config holds everything that can be changed without a rebuild.
+type Config struct {
+	LineNumber      string   `json:"line_number"`      // 35
+	DestinationCode string   `json:"destination_code"` // OLPP
+	PollInterval    Duration `json:"poll_interval"`    // how often OVAPI is asked for new data
+	MaxETA          Duration `json:"max_eta"`          // buses arriving later than this are not shown
+	Mode            string   `json:"mode"`             // cycle, multi-bus or clock
+
+	// Watches are the stops and buses shown. Without any, LineNumber
+	// and DestinationCode are watched at Olof Palmeplein.
+	Watches []Watch `json:"watches,omitempty"`
+
+	// RequestInterval is the least time between two requests to OVAPI,
+	// which are made at the same time for all stop areas.
+	RequestInterval Duration `json:"request_interval"`
+
+	// Websocket also follows the buses of the watches on the GVB maps websocket,
+	// showing what it hears in between the requests to OVAPI.
+	Websocket bool `json:"websocket,omitempty"`
+
+	// Listen is the address of the local HTTP server, e.g. `:8080`. Empty disables it.
+	Listen string `json:"listen,omitempty"`
+
+	// History is an append-only file every pass at the stop is recorded to,
+	// for the `report` command. Empty disables it.
+	History string `json:"history,omitempty"`
+
+	// Correct adjusts the ETAs by how late the buses turned out to be in the History,
+	// per line, weekday, hour and how far ahead they are. Corrected ETAs are marked.
+	Correct bool `json:"correct,omitempty"`
+
+	// StopsAway also fetches the journey of the next bus to show how many stops
+	// it still has to go, as a bar after its ETA in cycle mode.
+	StopsAway bool `json:"stops_away,omitempty"`
+
+	// Icons shows a pictogram of the bus, tram, metro or ferry in its colour
+	// before each ETA.
+	Icons bool `json:"icons,omitempty"`
+
+	// BootAnimation is a GIF, or a PNG shown for a few seconds, played once at startup
+	// instead of a bus driving in. A GIF looping forever stops when the first buses come in.
+	BootAnimation string `json:"boot_animation,omitempty"`
+
+	// Panels chain several unicornd displays into one larger sign,
+	// e.g. two pHATs side by side. Empty drives the pHAT on the default socket.
+	Panels []Panel `json:"panels,omitempty"`
+
+	Alerts     Alerts     `json:"alerts"`
+	Brightness Brightness `json:"brightness"`
+	Sleep      Sleep      `json:"sleep"`
+	Log        Log        `json:"log"`
+	Schedule   Schedule   `json:"schedule"`
+}
+
+// Watch is a stop and the buses of interest there.
+type Watch struct {
+	Name         string   `json:"name"`            // tells the watches apart in logs and on /arrivals
+	StopAreaCode string   `json:"stop_area_code"`  // as in v0.ovapi.nl/stopareacode/01346
+	Lines        []string `json:"lines,omitempty"` // LinePublicNumbers, e.g. 35; all when empty
+
+	// Direction is the LineDirection, 1 or 2, e.g. towards the city.
+	// Unlike a destination it includes short-turn trips and diversions. Both when 0.
+	Direction int `json:"direction,omitempty"`
+
+	// TimingPoints and UserStops pick the side of the road within the stop area,
+	// e.g. 30001346 and 01346. All when empty.
+	TimingPoints []string `json:"timing_points,omitempty"`
+	UserStops    []string `json:"user_stops,omitempty"`
+
+	Destinations        []string `json:"destinations,omitempty"`         // DestinationCodes allowed, e.g. OLPP; all when empty
+	ExcludeDestinations []string `json:"exclude_destinations,omitempty"` // DestinationCodes left out
+
+	// TransportTypes are the kinds of vehicles shown, BUS, TRAM, METRO or BOAT. All when empty.
+	TransportTypes []string `json:"transport_types,omitempty"`
+
+	// Wheelchair only shows vehicles that are wheelchair accessible.
+	Wheelchair bool `json:"wheelchair,omitempty"`
+
+	// WalkTime is how long it takes to get to the stop. Buses arriving sooner
+	// can not be caught and are not shown, and the rest is ordered by when to leave.
+	WalkTime Duration `json:"walk_time"`
+
+	// Color marks the ETAs of this watch, so they can be told apart. Unmarked when empty.
+	Color *Color `json:"color,omitempty"`
+}
+
+// Watchlist returns the watches, or the one of LineNumber and DestinationCode
+// at Olof Palmeplein when none are configured, to all destinations without a code.
+func (c Config) Watchlist() []Watch {
+	if len(c.Watches) > 0 {
+		return c.Watches
+	}
+	w := Watch{
+		Name:         "default",
+		StopAreaCode: "01346",
+		Lines:        []string{c.LineNumber},
+	}
+	if c.DestinationCode != "" {
+		w.Destinations = []string{c.DestinationCode}
+	}
+	return []Watch{w}
+}
+
+// Pixel orders of a Panel.
+const (
+	OrderSerpentine = "serpentine" // the Unicorn HAT
+	OrderRowMajor   = "row_major"  // the Unicorn pHAT
+)
+
+// Panel is a board taking part in the sign, driven by its own unicornd.
+type Panel struct {
+	Socket string `json:"socket"` // unix socket path, or tcp://host:port forwarded from another Pi
+
+	// X and Y are where the top left corner of the panel is on the sign.
+	X int `json:"x"`
+	Y int `json:"y"`
+
+	// Width and Height of the board, 8x4 for a pHAT. 8x8 when 0.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// Rotation turns the content clockwise, 0, 90, 180 or 270 degrees, e.g. 180
+	// for a board mounted upside down. The flips mirror it before the rotation.
+	Rotation int  `json:"rotation,omitempty"`
+	FlipH    bool `json:"flip_h,omitempty"`
+	FlipV    bool `json:"flip_v,omitempty"`
+
+	// Order is how the LEDs are chained, serpentine or row_major. Serpentine when empty.
+	Order string `json:"order,omitempty"`
+}
+
+// Schedule is the static timetable shown when no realtime data comes in.
+type Schedule struct {
+	// GTFS is a GTFS zip, e.g. gtfs-nl.zip from gtfs.ovapi.nl. Empty disables the fallback.
+	GTFS string `json:"gtfs,omitempty"`
+
+	// StopCode is the stop_code of the stop in stops.txt, its TimingPointCode.
+	// The timetable is of this one stop, so it is filtered like the one watch.
+	StopCode string `json:"stop_code"`
+
+	// Destinations maps the trip_headsign of GTFS onto destination codes,
+	// which GTFS does not have.
+	Destinations map[string]string `json:"destinations"`
+
+	// StaleAfter is how old the newest realtime update may be
+	// before the schedule is shown instead.
+	StaleAfter Duration `json:"stale_after"`
+}
+
+// Log configures what is logged to stderr.
+type Log struct {
+	Level  string `json:"level"`  // debug, info, warn or error
+	Format string `json:"format"` // logfmt or json
+}
+
+// Brightness configures the automatic brightness of the display.
+type Brightness struct {
+	Day   uint `json:"day"`   // 0..255, used in daylight
+	Night uint `json:"night"` // 0..255, used in the dark
+	Step  uint `json:"step"`  // max change per Interval, keeps transitions smooth
+
+	Interval Duration `json:"interval"`
+	Twilight Duration `json:"twilight"` // time to fade between Night and Day around sunrise and sunset
+
+	// Curve replaces the sunrise/sunset schedule with fixed levels during the day.
+	Curve []CurvePoint `json:"curve,omitempty"`
+
+	// Sensor is a sysfs file holding a light sensor value, e.g.
+	// /sys/bus/iio/devices/iio:device0/in_illuminance_input
+	// The value is scaled from 0..SensorMax onto Night..Day.
+	Sensor    string `json:"sensor,omitempty"`
+	SensorMax int    `json:"sensor_max,omitempty"`
+}
+
+// Alerts configures the messages of the operator about the stops and lines watched,
+// like diversions, which scroll by with a warning sign.
+type Alerts struct {
+	Hide bool `json:"hide,omitempty"`
+
+	// Interval is how often the alerts interrupt the buses, each scrolling by once.
+	// At 0 they are shown instead of the buses for as long as they last.
+	Interval Duration `json:"interval"`
+}
+
+// Sleep configures when the display is blanked and what wakes it up again.
+type Sleep struct {
+	QuietHours    []Period `json:"quiet_hours,omitempty"`
+	BlankWhenIdle bool     `json:"blank_when_idle"` // blank when there are no arrivals within max_eta
+
+	// WakeAt lists times of day at which the display wakes up for WakeFor,
+	// e.g. when leaving for work during quiet hours.
+	WakeAt  []Clock  `json:"wake_at,omitempty"`
+	WakeFor Duration `json:"wake_for"`
+
+	// Button is the sysfs value file of a GPIO, e.g. /sys/class/gpio/gpio17/value
+	// A press wakes the display up for WakeFor.
+	Button          string `json:"button,omitempty"`
+	ButtonActiveLow bool   `json:"button_active_low,omitempty"`
+}
+
+// Period is a time span within a day. It may wrap around midnight.
+type Period struct {
+	From Clock `json:"from"`
+	To   Clock `json:"to"`
+}
+
+// Contains reports whether c falls within the period.
+func (p Period) Contains(c Clock) bool {
+	if p.From <= p.To {
+		return c >= p.From && c < p.To
+	}
+	return c >= p.From || c < p.To
+}
+
+// CurvePoint sets the brightness Level at a time of day.
+type CurvePoint struct {
+	At    Clock `json:"at"`
+	Level uint  `json:"level"`
+}
+
+// Default returns the configuration the display was built around.
+func Default() Config {
+	return Config{
+		LineNumber:      "35",
+		DestinationCode: "OLPP",
+		PollInterval:    Duration{time.Second * 60},
+		MaxETA:          Duration{time.Minute * 35},
+		Mode:            ModeCycle,
+		RequestInterval: Duration{time.Millisecond * 500},
+		Alerts: Alerts{
+			Interval: Duration{time.Minute},
+		},
+		Brightness: Brightness{
+			Day:       60,
+			Night:     6,
+			Step:      2,
+			Interval:  Duration{time.Second * 10},
+			Twilight:  Duration{time.Minute * 45},
+			SensorMax: 1000,
+		},
+		Sleep: Sleep{
+			WakeFor: Duration{time.Minute * 15},
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logger.FormatLogfmt,
+		},
+		Schedule: Schedule{
+			StopCode:     "30001346",
+			Destinations: map[string]string{"Olof Palmeplein": "OLPP"},
+			StaleAfter:   Duration{time.Minute * 10},
+		},
+	}
+}
+
+// Load reads a JSON config file on top of the defaults.
+func Load(path string) (Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Default(), err
+	}
+
+	cfg, err := Parse(b)
+	if err != nil {
+		return cfg, fmt.Errorf("config %v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse reads a JSON config on top of the defaults and validates it.
+func Parse(b []byte) (Config, error) {
+	cfg := Default()
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("could not parse config: %v", err)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate reports the first setting that can not work.
+func (c Config) Validate() error {
+	switch {
+	case c.LineNumber == "" && len(c.Watches) == 0:
+		return fmt.Errorf("line_number or watches must be set")
+	case c.PollInterval.Duration < time.Second*10:
+		return fmt.Errorf("poll_interval must be at least 10s, passed: %v", c.PollInterval)
+	case c.MaxETA.Duration <= 0:
+		return fmt.Errorf("max_eta must be positive, passed: %v", c.MaxETA)
+	case c.RequestInterval.Duration < 0:
+		return fmt.Errorf("request_interval must not be negative, passed: %v", c.RequestInterval)
+	case c.Alerts.Interval.Duration < 0:
+		return fmt.Errorf("alerts interval must not be negative, passed: %v", c.Alerts.Interval)
+	case !ValidMode(c.Mode):
+		return fmt.Errorf("mode must be one of %v, passed: %v", strings.Join(Modes, ", "), c.Mode)
+	case c.Brightness.Day > 255 || c.Brightness.Night > 255:
+		return fmt.Errorf("brightness must be 0..255, passed day: %v, night: %v", c.Brightness.Day, c.Brightness.Night)
+	case c.Brightness.Interval.Duration <= 0:
+		return fmt.Errorf("brightness interval must be positive, passed: %v", c.Brightness.Interval)
+	case c.Brightness.Sensor != "" && c.Brightness.SensorMax <= 0:
+		return fmt.Errorf("brightness sensor_max must be positive, passed: %v", c.Brightness.SensorMax)
+	case c.Sleep.WakeFor.Duration <= 0:
+		return fmt.Errorf("sleep wake_for must be positive, passed: %v", c.Sleep.WakeFor)
+	case c.Schedule.GTFS != "" && c.Schedule.StaleAfter.Duration <= 0:
+		return fmt.Errorf("schedule stale_after must be positive, passed: %v", c.Schedule.StaleAfter)
+	case c.Schedule.GTFS != "" && len(c.Watches) > 1:
+		return fmt.Errorf("schedule is of one stop_code, it can only be used with one watch, passed: %d watches", len(c.Watches))
+	case c.Correct && c.History == "":
+		return fmt.Errorf("correct needs a history to learn from")
+	case c.Log.Format != logger.FormatLogfmt && c.Log.Format != logger.FormatJSON:
+		return fmt.Errorf("log format must be logfmt or json, passed: %v", c.Log.Format)
+	}
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for i, w := range c.Watches {
+		switch {
+		case w.Name == "":
+			return fmt.Errorf("watch %d must have a name", i+1)
+		case names[w.Name]:
+			return fmt.Errorf("watch names must be unique, passed: %v twice", w.Name)
+		case w.StopAreaCode == "":
+			return fmt.Errorf("watch %v must have a stop_area_code", w.Name)
+		case w.Direction < 0 || w.Direction > 2:
+			return fmt.Errorf("watch %v direction must be 1, 2 or 0 for both, passed: %v", w.Name, w.Direction)
+		case w.WalkTime.Duration < 0 || w.WalkTime.Duration >= c.MaxETA.Duration:
+			return fmt.Errorf("watch %v walk_time must be 0..max_eta, passed: %v", w.Name, w.WalkTime)
+		}
+		for _, t := range w.TransportTypes {
+			if !oneOf(t, TransportTypes) {
+				return fmt.Errorf("watch %v transport_types must be %v, passed: %v", w.Name, strings.Join(TransportTypes, ", "), t)
+			}
+		}
+		names[w.Name] = true
+	}
+
+	for i, p := range c.Panels {
+		switch {
+		case p.Socket == "":
+			return fmt.Errorf("panel %d must have a socket", i+1)
+		case p.X < 0 || p.Y < 0:
+			return fmt.Errorf("panel %d x and y must not be negative, passed: %v, %v", i+1, p.X, p.Y)
+		case p.Width < 0 || p.Width > 8 || p.Height < 0 || p.Height > 8:
+			return fmt.Errorf("panel %d width and height must be 1..8, passed: %v, %v", i+1, p.Width, p.Height)
+		case p.Rotation != 0 && p.Rotation != 90 && p.Rotation != 180 && p.Rotation != 270:
+			return fmt.Errorf("panel %d rotation must be 0, 90, 180 or 270, passed: %v", i+1, p.Rotation)
+		case p.Order != "" && p.Order != OrderSerpentine && p.Order != OrderRowMajor:
+			return fmt.Errorf("panel %d order must be %v or %v, passed: %v", i+1, OrderSerpentine, OrderRowMajor, p.Order)
+		}
+	}
+
+	for _, p := range c.Brightness.Curve {
+		if p.Level > 255 {
+			return fmt.Errorf("brightness curve level must be 0..255, passed: %v at %v", p.Level, p.At)
+		}
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration written as "60s" or "1m30s" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like `60s`, passed: %s", b)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Color is an RGB colour written as "#rrggbb" in JSON.
+type Color struct {
+	R, G, B uint8
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Color) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("color must be a string like `#ff8800`, passed: %s", b)
+	}
+
+	if _, err := fmt.Sscanf(strings.ToLower(s), "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil || len(s) != 7 {
+		return fmt.Errorf("color must look like `#ff8800`, passed: %v", s)
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// String returns the colour as #ff8800.
+func (c Color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Clock is a time of day written as "23:45" in JSON.
+type Clock time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Clock) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("time of day must be a string like `23:45`, passed: %s", b)
+	}
+
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("time of day must look like `23:45`, passed: %v", s)
+	}
+	*c = Clock(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Clock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// String returns the time of day as 23:45.
+func (c Clock) String() string {
+	d := time.Duration(c)
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Of returns the time of day of t.
+func Of(t time.Time) Clock {
+	h, m, s := t.Clock()
+	return Clock(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+}
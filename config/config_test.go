@@ -0,0 +1,194 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodContains(t *testing.T) {
+	clock := func(h, m int) Clock { return Clock(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	day := Period{From: clock(7, 0), To: clock(23, 0)}
+	night := Period{From: clock(23, 0), To: clock(6, 30)}
+
+	tests := []struct {
+		p    Period
+		c    Clock
+		want bool
+	}{
+		{day, clock(7, 0), true},
+		{day, clock(12, 0), true},
+		{day, clock(22, 59), true},
+		{day, clock(23, 0), false},
+		{day, clock(6, 59), false},
+		{night, clock(23, 0), true},
+		{night, clock(0, 0), true},
+		{night, clock(6, 29), true},
+		{night, clock(6, 30), false},
+		{night, clock(12, 0), false},
+		{night, clock(22, 59), false},
+		{Period{}, clock(12, 0), false}, // empty
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.p.Contains(tt.c), "%v-%v contains %v", tt.p.From, tt.p.To, tt.c)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	watch := func(fn func(w *Watch)) func(c *Config) {
+		return func(c *Config) {
+			w := Watch{Name: "bus", StopAreaCode: "01346"}
+			fn(&w)
+			c.Watches = []Watch{w}
+		}
+	}
+
+	tests := []struct {
+		name string
+		set  func(c *Config)
+		err  string // part of the error, "" when valid
+	}{
+		{"default", func(c *Config) {}, ""},
+		{"no line", func(c *Config) { c.LineNumber = "" }, "line_number or watches"},
+		{"poll interval", func(c *Config) { c.PollInterval.Duration = time.Second }, "poll_interval"},
+		{"max eta", func(c *Config) { c.MaxETA.Duration = 0 }, "max_eta"},
+		{"request interval", func(c *Config) { c.RequestInterval.Duration = -time.Second }, "request_interval"},
+		{"alerts interval", func(c *Config) { c.Alerts.Interval.Duration = -time.Second }, "alerts interval"},
+		{"alerts shown instead", func(c *Config) { c.Alerts.Interval.Duration = 0 }, ""},
+		{"mode", func(c *Config) { c.Mode = ModeMultiBus }, ""},
+		{"unknown mode", func(c *Config) { c.Mode = "fancy" }, "mode must be one of"},
+		{"brightness", func(c *Config) { c.Brightness.Day = 256 }, "brightness must be 0..255"},
+		{"brightness interval", func(c *Config) { c.Brightness.Interval.Duration = 0 }, "brightness interval"},
+		{"sensor", func(c *Config) { c.Brightness.Sensor = "/sys/lux" }, ""},
+		{"sensor max", func(c *Config) { c.Brightness.Sensor, c.Brightness.SensorMax = "/sys/lux", 0 }, "sensor_max"},
+		{"curve", func(c *Config) { c.Brightness.Curve = []CurvePoint{{Level: 255}} }, ""},
+		{"curve level", func(c *Config) { c.Brightness.Curve = []CurvePoint{{Level: 300}} }, "curve level"},
+		{"wake for", func(c *Config) { c.Sleep.WakeFor.Duration = 0 }, "wake_for"},
+		{"schedule", func(c *Config) { c.Schedule.GTFS = "gtfs.zip" }, ""},
+		{"schedule with a watch", func(c *Config) { watch(func(w *Watch) {})(c); c.Schedule.GTFS = "gtfs.zip" }, ""},
+		{"schedule with watches", func(c *Config) {
+			watch(func(w *Watch) {})(c)
+			c.Watches = append(c.Watches, Watch{Name: "tram", StopAreaCode: "08174"})
+			c.Schedule.GTFS = "gtfs.zip"
+		}, "only be used with one watch"},
+		{"schedule stale after", func(c *Config) { c.Schedule.GTFS, c.Schedule.StaleAfter.Duration = "gtfs.zip", 0 }, "stale_after"},
+		{"correct", func(c *Config) { c.Correct, c.History = true, "history.jsonl" }, ""},
+		{"correct without history", func(c *Config) { c.Correct = true }, "correct needs a history"},
+		{"log", func(c *Config) { c.Log = Log{Level: "debug", Format: "json"} }, ""},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "log format"},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, "loud"},
+		{"watch", watch(func(w *Watch) {}), ""},
+		{"watch without line", func(c *Config) { watch(func(w *Watch) {})(c); c.LineNumber = "" }, ""},
+		{"watch name", watch(func(w *Watch) { w.Name = "" }), "must have a name"},
+		{"watch names", func(c *Config) { watch(func(w *Watch) {})(c); c.Watches = append(c.Watches, c.Watches[0]) }, "unique"},
+		{"watch stop area", watch(func(w *Watch) { w.StopAreaCode = "" }), "stop_area_code"},
+		{"watch direction", watch(func(w *Watch) { w.Direction = 2 }), ""},
+		{"watch direction 3", watch(func(w *Watch) { w.Direction = 3 }), "direction must be 1, 2 or 0"},
+		{"watch walk time", watch(func(w *Watch) { w.WalkTime.Duration = time.Minute * 5 }), ""},
+		{"watch walk time past max eta", watch(func(w *Watch) { w.WalkTime.Duration = time.Hour }), "walk_time"},
+		{"watch negative walk time", watch(func(w *Watch) { w.WalkTime.Duration = -time.Minute }), "walk_time"},
+		{"watch filters", watch(func(w *Watch) {
+			w.TimingPoints, w.ExcludeDestinations, w.Wheelchair = []string{"30001346"}, []string{"GARA"}, true
+		}), ""},
+		{"watch transport types", watch(func(w *Watch) { w.TransportTypes = []string{"TRAM", "BOAT"} }), ""},
+		{"watch transport type", watch(func(w *Watch) { w.TransportTypes = []string{"tram"} }), "transport_types"},
+		{"panels", func(c *Config) {
+			c.Panels = []Panel{{Socket: "/var/run/unicornd.socket", Width: 8, Height: 4, Rotation: 180, Order: OrderRowMajor}, {Socket: "tcp://pi2:7777", X: 8}}
+		}, ""},
+		{"panel socket", func(c *Config) { c.Panels = []Panel{{}} }, "panel 1 must have a socket"},
+		{"panel offset", func(c *Config) { c.Panels = []Panel{{Socket: "a", X: -1}} }, "x and y"},
+		{"panel size", func(c *Config) { c.Panels = []Panel{{Socket: "a", Width: 16}} }, "width and height"},
+		{"panel rotation", func(c *Config) { c.Panels = []Panel{{Socket: "a", Rotation: 45}} }, "rotation"},
+		{"panel order", func(c *Config) { c.Panels = []Panel{{Socket: "a", Order: "zigzag"}} }, "order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.set(&c)
+			err := c.Validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	c := Default()
+	assert.Equal(t, []Watch{{Name: "default", StopAreaCode: "01346", Lines: []string{"35"}, Destinations: []string{"OLPP"}}}, c.Watchlist())
+
+	c.DestinationCode = ""
+	assert.Equal(t, []Watch{{Name: "default", StopAreaCode: "01346", Lines: []string{"35"}}}, c.Watchlist(), "to all destinations")
+
+	c.Watches = []Watch{{Name: "tram", StopAreaCode: "08174"}}
+	assert.Equal(t, c.Watches, c.Watchlist())
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(s string) string {
+		path := filepath.Join(dir, "config.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(s), 0644))
+		return path
+	}
+
+	// Set on top of the defaults.
+	cfg, err := Load(write(`{
+		"poll_interval": "30s",
+		"watches": [{"name": "tram", "stop_area_code": "08174", "walk_time": "6m", "color": "#0040ff", "transport_types": ["TRAM"]}],
+		"sleep": {"quiet_hours": [{"from": "23:00", "to": "06:30"}], "wake_at": ["05:50"]},
+		"alerts": {"hide": true},
+		"stops_away": true,
+		"icons": true,
+		"boot_animation": "boot.gif"
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*30, cfg.PollInterval.Duration)
+	assert.Equal(t, time.Minute*35, cfg.MaxETA.Duration, "default")
+	assert.Equal(t, "35", cfg.LineNumber, "default")
+	if assert.Len(t, cfg.Watchlist(), 1) {
+		w := cfg.Watchlist()[0]
+		assert.Equal(t, time.Minute*6, w.WalkTime.Duration)
+		assert.Equal(t, &Color{G: 0x40, B: 0xff}, w.Color)
+		assert.Equal(t, []string{"TRAM"}, w.TransportTypes)
+	}
+	assert.Equal(t, []Period{{From: Clock(time.Hour * 23), To: Clock(time.Hour*6 + time.Minute*30)}}, cfg.Sleep.QuietHours)
+	assert.Equal(t, "05:50", cfg.Sleep.WakeAt[0].String())
+	assert.True(t, cfg.Alerts.Hide)
+	assert.Equal(t, time.Minute, cfg.Alerts.Interval.Duration, "default")
+	assert.True(t, cfg.StopsAway)
+	assert.True(t, cfg.Icons)
+	assert.Equal(t, "boot.gif", cfg.BootAnimation)
+
+	// Without watches, the default one.
+	cfg, err = Load(write(`{"line_number": "15", "destination_code": "STZD"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Watch{{Name: "default", StopAreaCode: "01346", Lines: []string{"15"}, Destinations: []string{"STZD"}}}, cfg.Watchlist())
+
+	for _, bad := range []string{
+		`{"poll_interval": 60}`,
+		`{"poll_interval": "a minute"}`,
+		`{"poll_interval": "5s"}`,
+		`{"watches": [{"name": "bus", "stop_area_code": "01346", "color": "blue"}]}`,
+		`{"sleep": {"wake_at": ["6 o'clock"]}}`,
+		`{"mode": "fancy"}`,
+		`{`,
+	} {
+		_, err := Load(write(bad))
+		assert.Error(t, err, bad)
+		assert.Contains(t, err.Error(), "config.json", bad)
+	}
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// controlState is the JSON served on GET /control.
+type controlState struct {
+	Mode       string    `json:"mode"`
+	Paused     bool      `json:"paused"`
+	Blanked    bool      `json:"blanked"`
+	Brightness *uint     `json:"brightness,omitempty"` // only when held
+	Messages   []message `json:"messages"`
+}
+
+// handleControl serves the remote control settings.
+func (s *server) handleControl(w http.ResponseWriter, r *http.Request) {
+	mode, paused, blanked, messages := s.sch.State()
+	st := controlState{
+		Mode:     mode,
+		Paused:   paused,
+		Blanked:  blanked,
+		Messages: messages,
+	}
+	if v, ok := s.bc.Held(s.clock.Now()); ok {
+		st.Brightness = &v
+	}
+	s.writeJSON(w, st)
+}
+
+// handleBrightness holds the brightness on POST, e.g. `{"level": 40, "for": "1h"}`,
+// and returns to automatic brightness on DELETE.
+func (s *server) handleBrightness(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		s.log.Info("brightness back to automatic")
+		s.bc.Release()
+	case http.MethodPost:
+		var req struct {
+			Level *uint           `json:"level"`
+			For   config.Duration `json:"for"`
+		}
+		if !decode(w, r, &req) {
+			return
+		}
+		if req.Level == nil || *req.Level > 255 {
+			http.Error(w, "level must be 0..255", http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("brightness held", "level", *req.Level, "for", req.For.Duration)
+		s.bc.Hold(*req.Level, req.For.Duration, s.clock.Now())
+	default:
+		http.Error(w, "use POST or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.bc.Update(s.sch.c, s.clock.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMode switches the display mode, e.g. `{"mode": "clock"}`.
+func (s *server) handleMode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if !post(w, r) || !decode(w, r, &req) {
+		return
+	}
+	if err := s.sch.SetMode(req.Mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.log.Info("display mode set", "mode", req.Mode)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePause freezes the display, e.g. `{"paused": true}`.
+func (s *server) handlePause(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paused bool `json:"paused"`
+	}
+	if !post(w, r) || !decode(w, r, &req) {
+		return
+	}
+
+	s.log.Info("display paused", "paused", req.Paused)
+	s.sch.Pause(req.Paused)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBlank turns the display off, e.g. `{"blanked": true}`.
+func (s *server) handleBlank(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Blanked bool `json:"blanked"`
+	}
+	if !post(w, r) || !decode(w, r, &req) {
+		return
+	}
+
+	s.log.Info("display blanked", "blanked", req.Blanked)
+	s.sch.Blank(req.Blanked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMessage shows a text instead of the buses on POST, e.g.
+// `{"text": "dinner!", "ttl": "5m", "priority": 1, "color": "#ff0000"}`,
+// and removes all messages on DELETE.
+func (s *server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.log.Info("messages cleared")
+		s.sch.ClearMessages()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req struct {
+		Text     string          `json:"text"`
+		TTL      config.Duration `json:"ttl"`
+		Priority int             `json:"priority"`
+		Color    string          `json:"color"`
+	}
+	if !post(w, r) || !decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		http.Error(w, "text must be set", http.StatusBadRequest)
+		return
+	}
+	if req.TTL.Duration <= 0 {
+		req.TTL.Duration = time.Minute
+	}
+
+	m := message{
+		Text:     req.Text,
+		Color:    unicorn.Pixel{R: 255, G: 255, B: 255},
+		Priority: req.Priority,
+		Expires:  s.clock.Now().Add(req.TTL.Duration),
+	}
+	if req.Color != "" {
+		var err error
+		if m.Color, err = unicorn.ParseColor(req.Color); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.log.Info("showing message", "text", m.Text, "ttl", req.TTL.Duration, "priority", m.Priority)
+	s.sch.Push(m)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func post(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+func TestControlBrightness(t *testing.T) {
+	s := newTestServer(t)
+	now := s.clock.Now()
+
+	tests := []struct {
+		method string
+		body   string
+		code   int
+	}{
+		{http.MethodPost, `{"level": 40, "for": "1h"}`, http.StatusNoContent},
+		{http.MethodPost, `{"level": 0}`, http.StatusNoContent},
+		{http.MethodPost, `{"level": 255}`, http.StatusNoContent},
+		{http.MethodPost, `{"for": "1h"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"level": 256}`, http.StatusBadRequest},
+		{http.MethodPost, `{"level": -1}`, http.StatusBadRequest},
+		{http.MethodPost, `{"level": 40, "for": "an hour"}`, http.StatusBadRequest},
+		{http.MethodPost, `level=40`, http.StatusBadRequest},
+		{http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, request(s, tt.method, "/control/brightness", tt.body).Code, "%v %v", tt.method, tt.body)
+	}
+
+	// Held until released.
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/brightness", `{"level": 40, "for": "1h"}`).Code)
+	v, ok := s.bc.Held(now)
+	assert.True(t, ok)
+	assert.Equal(t, uint(40), v)
+	var st controlState
+	assert.NoError(t, json.Unmarshal(request(s, http.MethodGet, "/control", "").Body.Bytes(), &st))
+	if assert.NotNil(t, st.Brightness) {
+		assert.Equal(t, uint(40), *st.Brightness)
+	}
+
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodDelete, "/control/brightness", "").Code)
+	_, ok = s.bc.Held(now)
+	assert.False(t, ok)
+	st = controlState{}
+	assert.NoError(t, json.Unmarshal(request(s, http.MethodGet, "/control", "").Body.Bytes(), &st))
+	assert.Nil(t, st.Brightness)
+}
+
+func TestControlMode(t *testing.T) {
+	s := newTestServer(t)
+
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/mode", `{"mode": "clock"}`).Code)
+	assert.Equal(t, config.ModeClock, s.sch.Mode())
+
+	for _, body := range []string{`{"mode": "fancy"}`, `{"mode": ""}`, `{}`, `clock`} {
+		assert.Equal(t, http.StatusBadRequest, request(s, http.MethodPost, "/control/mode", body).Code, body)
+	}
+	assert.Equal(t, config.ModeClock, s.sch.Mode(), "kept")
+	assert.Equal(t, http.StatusMethodNotAllowed, request(s, http.MethodGet, "/control/mode", "").Code)
+}
+
+func TestControlPauseBlank(t *testing.T) {
+	s := newTestServer(t)
+	state := func() controlState {
+		var st controlState
+		assert.NoError(t, json.Unmarshal(request(s, http.MethodGet, "/control", "").Body.Bytes(), &st))
+		return st
+	}
+	assert.Equal(t, controlState{Mode: config.ModeCycle}, state())
+
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/pause", `{"paused": true}`).Code)
+	assert.True(t, state().Paused)
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/blank", `{"blanked": true}`).Code)
+	assert.True(t, state().Blanked)
+
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/pause", `{"paused": false}`).Code)
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/blank", `{}`).Code)
+	st := state()
+	assert.False(t, st.Paused)
+	assert.False(t, st.Blanked)
+
+	assert.Equal(t, http.StatusBadRequest, request(s, http.MethodPost, "/control/pause", `yes`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(s, http.MethodPut, "/control/blank", `{"blanked": true}`).Code)
+	assert.False(t, state().Blanked)
+}
+
+func TestControlMessage(t *testing.T) {
+	s := newTestServer(t)
+	now := s.clock.Now()
+
+	for _, body := range []string{
+		`{"text": "dinner!"}`,
+		`{"text": "urgent", "priority": 2, "ttl": "5m", "color": "#ff8000"}`,
+		`{"text": "later", "priority": 1, "ttl": "-1m"}`,
+	} {
+		assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/control/message", body).Code, body)
+	}
+	for _, body := range []string{`{"text": ""}`, `{"text": "hi", "color": "red"}`, `{"text": "hi", "ttl": 5}`, `hi`} {
+		assert.Equal(t, http.StatusBadRequest, request(s, http.MethodPost, "/control/message", body).Code, body)
+	}
+
+	_, _, _, messages := s.sch.State()
+	assert.Equal(t, []message{
+		{Text: "urgent", Color: unicorn.Pixel{R: 255, G: 128}, Priority: 2, Expires: now.Add(time.Minute * 5)},
+		{Text: "later", Color: unicorn.Pixel{R: 255, G: 255, B: 255}, Priority: 1, Expires: now.Add(time.Minute)},
+		{Text: "dinner!", Color: unicorn.Pixel{R: 255, G: 255, B: 255}, Expires: now.Add(time.Minute)},
+	}, messages, "by priority, white and for a minute unless set")
+
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodDelete, "/control/message", "").Code)
+	_, _, _, messages = s.sch.State()
+	assert.Empty(t, messages)
+}
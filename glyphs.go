@@ -0,0 +1,117 @@
+package main
+
+import (
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// displayTransform maps the logical 8x4 display onto our pHAT,
+// which is mounted upside down.
+var displayTransform = unicorn.Transform{
+	Width:    8,
+	Height:   4,
+	Rotation: unicorn.Rotate180,
+	Order:    unicorn.RowMajor,
+}
+
+// displayWidth and displayHeight are the size of the logical display: the pHAT,
+// or the sign made of the panels of the config. openDisplay sets them before drawing starts.
+var displayWidth, displayHeight = displayTransform.Size()
+
+var exclamationMark = []string{
+	"........",
+	"........",
+	"#####.##",
+	"#####.##",
+}
+
+// warningSign goes in front of alerts.
+var warningSign = []string{
+	"...#...",
+	"..#.#..",
+	".#.#.#.",
+	"#######",
+}
+
+var (
+	alertColor    = unicorn.Pixel{R: 230, G: 150} // orange, like a warning sign
+	calamityColor = unicorn.Pixel{R: 255}
+)
+
+var (
+	stopPoleColor = unicorn.Pixel{R: 255, G: 255, B: 255}
+	roadColor     = unicorn.Pixel{R: 25, G: 25, B: 25}
+)
+
+// idleColor draws the dashes shown when no bus is coming.
+var idleColor = unicorn.Pixel{R: 40, G: 40, B: 40}
+
+// idleFrame shows two dashes where the minutes go, like a departure board without departures.
+func idleFrame() unicorn.Matrix {
+	cv := newCanvas()
+	unicorn.DrawGlyph(cv, unicorn.Glyph('-'), 0, 0, idleColor)
+	unicorn.DrawGlyph(cv, unicorn.Glyph('-'), 5, 0, idleColor)
+	return cv.Matrix(0, 0)
+}
+
+// correctedMark is the dot next to an ETA that was corrected.
+var correctedMark = unicorn.Pixel{B: 120}
+
+// wheelchairMark is the dot next to an ETA of a wheelchair accessible vehicle.
+var wheelchairMark = unicorn.Pixel{R: 140, G: 140, B: 255}
+
+// transportIcons are the unicorn.Icons of the transport types.
+var transportIcons = map[string]string{
+	arrivals.TransportBus:   unicorn.IconBus,
+	arrivals.TransportTram:  unicorn.IconTram,
+	arrivals.TransportMetro: unicorn.IconMetro,
+	arrivals.TransportBoat:  unicorn.IconFerry,
+}
+
+// transportColors draw the icons of the transport types.
+var transportColors = map[string]unicorn.Pixel{
+	arrivals.TransportBus:   {G: 110, B: 255}, // blue
+	arrivals.TransportTram:  {R: 255, G: 200}, // yellow
+	arrivals.TransportMetro: {R: 255, G: 40, B: 40},
+	arrivals.TransportBoat:  {G: 200, B: 200}, // teal
+}
+
+// transportIcon returns the icon of transport that fits the display and its colour,
+// nil when there is none.
+func transportIcon(transport string) ([]string, unicorn.Pixel) {
+	return unicorn.Icon(transportIcons[transport], displayHeight), transportColors[transport]
+}
+
+// bootAnimation drives the bus icon in from the right, then fades it out.
+func bootAnimation() unicorn.Sprite {
+	g, p := transportIcon(arrivals.TransportBus)
+	bus := unicorn.FrameFromASCII(g, map[rune]unicorn.Pixel{'#': p}, time.Millisecond*60)
+	s := unicorn.Sprite{Loops: 1}
+	for x := displayWidth; x >= 0; x-- {
+		f := bus
+		f.X = x
+		s.Frames = append(s.Frames, f)
+	}
+	s.Frames[len(s.Frames)-1].Duration = time.Millisecond * 500
+	for _, a := range []uint8{192, 128, 64} {
+		f := bus.Faded(a)
+		f.Duration = time.Millisecond * 80
+		s.Frames = append(s.Frames, f)
+	}
+	return s
+}
+
+// scheduledColor draws ETAs from the timetable, which are not realtime.
+var scheduledColor = unicorn.Pixel{R: 90, G: 40, B: 255}
+
+// newCanvas returns an empty canvas the size of the display.
+func newCanvas() *unicorn.Canvas {
+	return unicorn.NewCanvas(displayWidth, displayHeight)
+}
+
+// drawDigit draws d at column x; 0 is the left and 5 the right position.
+func drawDigit(cv *unicorn.Canvas, d, x int, p unicorn.Pixel) {
+	unicorn.DrawGlyph(cv, unicorn.Glyph(rune('0'+d)), x, 0, p)
+}
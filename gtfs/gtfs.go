@@ -0,0 +1,320 @@
+// Package gtfs reads the planned arrivals at a single stop from a static
+// GTFS feed, such as the one exported on gtfs.ovapi.nl, to fall back on
+// when no realtime data comes in.
+//
+// Only the rows of the stop are kept in memory, so the feed of the whole
+// country can be used.
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Arrival is a planned arrival at the stop.
+type Arrival struct {
+	TripID   string
+	Line     string // route_short_name, e.g. 35
+	Type     int    // route_type, e.g. 3 for a bus, -1 when unknown
+	Headsign string // trip_headsign, e.g. Olof Palmeplein
+	Time     time.Time
+}
+
+// Timetable holds the planned arrivals at a stop.
+type Timetable struct {
+	loc       *time.Location
+	stopTimes []stopTime
+	trips     map[string]trip
+	routes    map[string]route // by route_id
+	services  map[string]*service
+}
+
+type route struct {
+	shortName string
+	kind      int // route_type
+}
+
+type stopTime struct {
+	tripID  string
+	arrival time.Duration // since noon minus 12h of the service day, may exceed 24h
+}
+
+type trip struct {
+	routeID   string
+	serviceID string
+	headsign  string
+}
+
+// service is a calendar.txt row with the exceptions of calendar_dates.txt.
+type service struct {
+	weekdays   [7]bool // Sunday first, like time.Weekday
+	start, end string  // 20190102
+	added      map[string]bool
+	removed    map[string]bool
+}
+
+func (s *service) runsOn(date string, wd time.Weekday) bool {
+	switch {
+	case s.added[date]:
+		return true
+	case s.removed[date]:
+		return false
+	}
+	return s.start != "" && date >= s.start && date <= s.end && s.weekdays[wd]
+}
+
+// Load reads the arrivals at the stop with stopCode, the stop_code or stop_id
+// in stops.txt, from the GTFS zip at path.
+func Load(path, stopCode string) (*Timetable, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	tt := &Timetable{
+		loc:      time.Local,
+		trips:    map[string]trip{},
+		routes:   map[string]route{},
+		services: map[string]*service{},
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	read := func(name string, optional bool, fn func(row map[string]string) error) error {
+		f, ok := files[name]
+		if !ok {
+			if optional {
+				return nil
+			}
+			return fmt.Errorf("gtfs feed %v has no %v", path, name)
+		}
+		if err := readCSV(f, fn); err != nil {
+			return fmt.Errorf("could not read %v: %v", name, err)
+		}
+		return nil
+	}
+
+	err = read("agency.txt", true, func(row map[string]string) error {
+		if loc, err := time.LoadLocation(row["agency_timezone"]); err == nil {
+			tt.loc = loc
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stops := map[string]bool{}
+	err = read("stops.txt", false, func(row map[string]string) error {
+		if row["stop_code"] == stopCode || row["stop_id"] == stopCode {
+			stops[row["stop_id"]] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("gtfs feed %v has no stop %v", path, stopCode)
+	}
+
+	err = read("stop_times.txt", false, func(row map[string]string) error {
+		if !stops[row["stop_id"]] {
+			return nil
+		}
+		at, err := parseTime(row["arrival_time"])
+		if err != nil {
+			return err
+		}
+		tt.stopTimes = append(tt.stopTimes, stopTime{tripID: row["trip_id"], arrival: at})
+		tt.trips[row["trip_id"]] = trip{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = read("trips.txt", false, func(row map[string]string) error {
+		if _, ok := tt.trips[row["trip_id"]]; !ok {
+			return nil
+		}
+		tt.trips[row["trip_id"]] = trip{
+			routeID:   row["route_id"],
+			serviceID: row["service_id"],
+			headsign:  row["trip_headsign"],
+		}
+		tt.routes[row["route_id"]] = route{kind: -1}
+		if _, ok := tt.services[row["service_id"]]; !ok {
+			tt.services[row["service_id"]] = &service{added: map[string]bool{}, removed: map[string]bool{}}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = read("routes.txt", false, func(row map[string]string) error {
+		if _, ok := tt.routes[row["route_id"]]; ok {
+			r := route{shortName: row["route_short_name"], kind: -1}
+			if v, err := strconv.Atoi(row["route_type"]); err == nil {
+				r.kind = v
+			}
+			tt.routes[row["route_id"]] = r
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = read("calendar.txt", true, func(row map[string]string) error {
+		s, ok := tt.services[row["service_id"]]
+		if !ok {
+			return nil
+		}
+		for i, day := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+			s.weekdays[i] = row[day] == "1"
+		}
+		s.start, s.end = row["start_date"], row["end_date"]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = read("calendar_dates.txt", true, func(row map[string]string) error {
+		s, ok := tt.services[row["service_id"]]
+		if !ok {
+			return nil
+		}
+		switch row["exception_type"] {
+		case "1":
+			s.added[row["date"]] = true
+		case "2":
+			s.removed[row["date"]] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+// Arrivals returns the arrivals planned from up to to, ordered by time.
+func (tt *Timetable) Arrivals(from, to time.Time) []Arrival {
+	var out []Arrival
+
+	// Trips of the day before may run past midnight. Days start at midnight,
+	// so a window across it reaches the trips of the next one too.
+	y, m, d := from.In(tt.loc).Date()
+	day := time.Date(y, m, d-1, 0, 0, 0, 0, tt.loc)
+	for ; !day.After(to); day = day.AddDate(0, 0, 1) {
+		y, m, d := day.Date()
+		date := fmt.Sprintf("%04d%02d%02d", y, m, d)
+		// Times are relative to noon minus 12h, which is midnight except on DST changes.
+		origin := time.Date(y, m, d, 12, 0, 0, 0, tt.loc).Add(-time.Hour * 12)
+
+		for _, st := range tt.stopTimes {
+			tr := tt.trips[st.tripID]
+			s, ok := tt.services[tr.serviceID]
+			if !ok || !s.runsOn(date, day.Weekday()) {
+				continue
+			}
+
+			at := origin.Add(st.arrival)
+			if at.Before(from) || at.After(to) {
+				continue
+			}
+			out = append(out, Arrival{
+				TripID:   st.tripID,
+				Line:     tt.routes[tr.routeID].shortName,
+				Type:     tt.routes[tr.routeID].kind,
+				Headsign: tr.headsign,
+				Time:     at,
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out
+}
+
+// Len returns the number of stop times at the stop.
+func (tt *Timetable) Len() int {
+	return len(tt.stopTimes)
+}
+
+// readCSV calls fn with every row of f by column name.
+func readCSV(f *zip.File, fn func(row map[string]string) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r := csv.NewReader(rc)
+	r.ReuseRecord = true
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	header = append([]string(nil), header...)
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // byte order mark
+	}
+
+	row := map[string]string{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for i, name := range header {
+			row[name] = ""
+			if i < len(rec) {
+				row[name] = rec[i]
+			}
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// parseTime parses a GTFS time like 25:10:00.
+func parseTime(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("time must look like `25:10:00`, passed: %v", s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		v, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("time must look like `25:10:00`, passed: %v", s)
+		}
+		d += time.Duration(v) * unit
+	}
+	return d, nil
+}
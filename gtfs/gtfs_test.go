@@ -0,0 +1,93 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var feed = map[string]string{
+	"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\n" +
+		"GVB,GVB,https://gvb.nl,Europe/Amsterdam\n",
+	"stops.txt": "stop_id,stop_code,stop_name\n" +
+		"1,30001346,Olof Palmeplein\n" +
+		"2,30001347,Somewhere else\n",
+	"routes.txt": "route_id,route_short_name,route_type\n" +
+		"r35,35,3\n" +
+		"r15,15,\n",
+	"trips.txt": "route_id,service_id,trip_id,trip_headsign\n" +
+		"r35,weekdays,t1,Olof Palmeplein\n" +
+		"r35,weekdays,t2,Olof Palmeplein\n" +
+		"r35,weekdays,t4,Olof Palmeplein\n" +
+		"r15,sundays,t3,Station Zuid\n",
+	"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"t1,08:10:00,08:10:00,1,1\n" +
+		"t2,24:05:00,24:05:00,1,1\n" +
+		"t3,08:20:00,08:20:00,1,1\n" +
+		"t4,00:20:00,00:20:00,1,1\n" +
+		"t1,08:15:00,08:15:00,2,2\n",
+	"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+		"weekdays,1,1,1,1,1,0,0,20190101,20191231\n",
+	"calendar_dates.txt": "service_id,date,exception_type\n" +
+		"weekdays,20190103,2\n" +
+		"sundays,20190106,1\n",
+}
+
+func TestTimetable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gtfs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gtfs.zip")
+
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range feed {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+
+	tt, err := Load(path, "30001346")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, tt.Len())
+
+	ams, _ := time.LoadLocation("Europe/Amsterdam")
+	day := func(d, h, m int) time.Time { return time.Date(2019, 1, d, h, m, 0, 0, ams) }
+
+	// Wednesday, and the trip after midnight of Tuesday.
+	got := tt.Arrivals(day(2, 0, 0), day(3, 0, 10))
+	if assert.Len(t, got, 4) {
+		assert.Equal(t, Arrival{TripID: "t2", Line: "35", Type: 3, Headsign: "Olof Palmeplein", Time: day(2, 0, 5)}, got[0])
+		assert.Equal(t, day(2, 0, 20), got[1].Time)
+		assert.Equal(t, day(2, 8, 10), got[2].Time)
+		assert.Equal(t, day(3, 0, 5), got[3].Time)
+	}
+
+	// Across midnight: the trip of Tuesday after midnight and the first one of Wednesday.
+	got = tt.Arrivals(day(1, 23, 50), day(2, 0, 25))
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, "t2", got[0].TripID)
+		assert.Equal(t, day(2, 0, 5), got[0].Time)
+		assert.Equal(t, "t4", got[1].TripID)
+		assert.Equal(t, day(2, 0, 20), got[1].Time)
+	}
+
+	// Thursday is cancelled, Sunday only runs line 15.
+	assert.Empty(t, tt.Arrivals(day(3, 1, 0), day(3, 23, 0)))
+	got = tt.Arrivals(day(6, 1, 0), day(6, 23, 0))
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, "15", got[0].Line)
+		assert.Equal(t, -1, got[0].Type)
+	}
+
+	_, err = Load(path, "99999999")
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// Horizons bound the buckets of time left until a predicted arrival:
+// up to 2 minutes, 2 to 5 minutes, and so on, and over 20 minutes.
+var Horizons = []time.Duration{
+	time.Minute * 2,
+	time.Minute * 5,
+	time.Minute * 10,
+	time.Minute * 20,
+}
+
+// minSamples is the least number of predictions a bias is learned from.
+// Buckets with less fall back to a coarser one.
+const minSamples = 5
+
+// minBias is the least bias worth correcting for.
+const minBias = time.Second * 30
+
+// every stands for all weekdays or all hours in a bucket.
+const every = -1
+
+type bucket struct {
+	line    string
+	weekday int
+	hour    int
+	horizon int
+}
+
+type mean struct {
+	sum time.Duration
+	n   int
+}
+
+// Model holds how late the arrivals were compared to their prediction,
+// per line, weekday, hour of the day and prediction horizon.
+type Model struct {
+	loc   *time.Location
+	means map[bucket]*mean
+}
+
+// Learn returns the Model of the arrived records, with weekdays
+// and hours of the day in loc.
+func Learn(records []Record, loc *time.Location) *Model {
+	m := &Model{loc: loc, means: map[bucket]*mean{}}
+	for _, r := range records {
+		if !r.Arrived() {
+			continue
+		}
+		for _, u := range r.Updates {
+			if !u.At.Before(r.Actual) {
+				continue
+			}
+			for _, b := range m.buckets(r.Line, u.Expected, u.At) {
+				v, ok := m.means[b]
+				if !ok {
+					v = &mean{}
+					m.means[b] = v
+				}
+				v.sum += r.Actual.Sub(u.Expected)
+				v.n++
+			}
+		}
+	}
+
+	return m
+}
+
+// Bias returns how much later than expected a bus of line arrives
+// when predicted at, and whether enough was learned to tell.
+func (m *Model) Bias(line string, expected, at time.Time) (time.Duration, bool) {
+	for _, b := range m.buckets(line, expected, at) {
+		if v, ok := m.means[b]; ok && v.n >= minSamples {
+			return v.sum / time.Duration(v.n), true
+		}
+	}
+	return 0, false
+}
+
+// Correct returns the expected arrival adjusted by the Bias,
+// and whether it was changed.
+func (m *Model) Correct(line string, expected, at time.Time) (time.Time, bool) {
+	bias, ok := m.Bias(line, expected, at)
+	if !ok || abs(bias) < minBias {
+		return expected, false
+	}
+	return expected.Add(bias), true
+}
+
+// buckets returns the buckets of a prediction, most specific first.
+func (m *Model) buckets(line string, expected, at time.Time) []bucket {
+	t := expected.In(m.loc)
+	h := horizon(expected.Sub(at))
+
+	return []bucket{
+		{line, int(t.Weekday()), t.Hour(), h},
+		{line, every, t.Hour(), h},
+		{line, every, every, h},
+	}
+}
+
+// horizon returns the index of the bucket of Horizons d falls in.
+func horizon(d time.Duration) int {
+	for i, h := range Horizons {
+		if d <= h {
+			return i
+		}
+	}
+	return len(Horizons)
+}
+
+// Accuracy compares the predictions within a horizon with and without correction.
+type Accuracy struct {
+	Horizon     string // e.g. 2m-5m, all for every horizon
+	Predictions int
+
+	// Raw and Corrected are the mean absolute error of the predictions.
+	Raw       time.Duration
+	Corrected time.Duration
+	Improved  int // predictions the correction brought closer
+}
+
+// Evaluate learns a Model from train and returns how it does on the predictions
+// in test, per horizon followed by all of them.
+func Evaluate(train, test []Record, loc *time.Location) []Accuracy {
+	m := Learn(train, loc)
+
+	out := make([]Accuracy, len(Horizons)+2)
+	for i := range out {
+		switch {
+		case i == 0:
+			out[i].Horizon = fmt.Sprintf("0-%v", shortDuration(Horizons[0]))
+		case i < len(Horizons):
+			out[i].Horizon = fmt.Sprintf("%v-%v", shortDuration(Horizons[i-1]), shortDuration(Horizons[i]))
+		case i == len(Horizons):
+			out[i].Horizon = fmt.Sprintf("%v+", shortDuration(Horizons[i-1]))
+		default:
+			out[i].Horizon = "all"
+		}
+	}
+
+	raw := make([]time.Duration, len(out))
+	corrected := make([]time.Duration, len(out))
+	for _, r := range test {
+		if !r.Arrived() {
+			continue
+		}
+		for _, u := range r.Updates {
+			if !u.At.Before(r.Actual) {
+				continue
+			}
+			c, _ := m.Correct(r.Line, u.Expected, u.At)
+			rawErr, corrErr := abs(r.Actual.Sub(u.Expected)), abs(r.Actual.Sub(c))
+
+			for _, i := range []int{horizon(u.Expected.Sub(u.At)), len(out) - 1} {
+				out[i].Predictions++
+				raw[i] += rawErr
+				corrected[i] += corrErr
+				if corrErr < rawErr {
+					out[i].Improved++
+				}
+			}
+		}
+	}
+
+	for i := range out {
+		if n := time.Duration(out[i].Predictions); n > 0 {
+			out[i].Raw = raw[i] / n
+			out[i].Corrected = corrected[i] / n
+		}
+	}
+	return out
+}
+
+// shortDuration writes 5m0s as 5m.
+func shortDuration(d time.Duration) string {
+	return fmt.Sprintf("%vm", int(d.Minutes()))
+}
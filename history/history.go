@@ -0,0 +1,235 @@
+// Package history records every pass seen at the stop to an append-only file
+// and turns it back into arrivals with their predictions, to tell how
+// reliable the buses and their ETAs really are.
+//
+// The file holds one JSON event per line. An event is written whenever a pass
+// shows up, its ExpectedArrivalTime or status changes, or it disappears.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Statuses of a pass, as in the TripStopStatus of OVAPI.
+// StatusGone is written by the Recorder when a pass is no longer served.
+const (
+	StatusArrived = "ARRIVED"
+	StatusPassed  = "PASSED"
+	StatusGone    = "GONE"
+)
+
+// arrivalSlack is how long before its expected arrival a pass may disappear
+// and still count as arrived at that time: one poll_interval plus some margin.
+const arrivalSlack = time.Minute * 2
+
+// forgetAfter is how long a pass that disappeared is remembered,
+// so it is not recorded as gone twice.
+const forgetAfter = time.Hour * 6
+
+// Pass is a bus at the stop as seen on one fetch.
+type Pass struct {
+	OperationDate string    `json:"operation_date"` // 2019-01-02
+	JourneyNumber int       `json:"journey"`
+	Line          string    `json:"line"`
+	Destination   string    `json:"destination"`
+	Stop          string    `json:"stop,omitempty"` // TimingPointCode, empty in files written before it was recorded
+	Status        string    `json:"status"`
+	Target        time.Time `json:"target"`   // TargetArrivalTime, as planned
+	Expected      time.Time `json:"expected"` // ExpectedArrivalTime, as predicted
+}
+
+// Key identifies the journey of a pass. Journey numbers are only
+// unique within a line and operation date, so all three make up the key,
+// and the stop when a journey may pass more than one.
+func (p Pass) Key() string {
+	if p.Stop != "" {
+		return fmt.Sprintf("%v/%v/%v/%v", p.OperationDate, p.Line, p.JourneyNumber, p.Stop)
+	}
+	return fmt.Sprintf("%v/%v/%v", p.OperationDate, p.Line, p.JourneyNumber)
+}
+
+// event is a line in the history file.
+type event struct {
+	At time.Time `json:"at"`
+	Pass
+}
+
+// Recorder appends changes in the passes to the history file.
+// It is used from a single goroutine.
+type Recorder struct {
+	f    *os.File
+	seen map[string]seen
+}
+
+type seen struct {
+	pass Pass
+	at   time.Time
+	gone bool
+}
+
+// Open opens the history file at path for appending, creating it if needed.
+func Open(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{f: f, seen: map[string]seen{}}, nil
+}
+
+// Record writes the passes that are new or changed since the last call,
+// and the ones that disappeared since, as seen at now.
+func (r *Recorder) Record(now time.Time, passes []Pass) error {
+	var events []event
+
+	current := map[string]bool{}
+	for _, p := range passes {
+		k := p.Key()
+		current[k] = true
+
+		last, ok := r.seen[k]
+		r.seen[k] = seen{pass: p, at: now}
+		if ok && !last.gone && last.pass.Status == p.Status && last.pass.Expected.Equal(p.Expected) {
+			continue
+		}
+		events = append(events, event{At: now, Pass: p})
+	}
+
+	for k, s := range r.seen {
+		switch {
+		case current[k]:
+		case now.Sub(s.at) > forgetAfter:
+			delete(r.seen, k)
+		case !s.gone:
+			s.gone = true
+			r.seen[k] = s
+
+			p := s.pass
+			p.Status = StatusGone
+			events = append(events, event{At: now, Pass: p})
+		}
+	}
+
+	w := bufio.NewWriter(r.f)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// Close closes the history file.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// Update is a prediction of the arrival made at a point in time.
+type Update struct {
+	At       time.Time `json:"at"`
+	Expected time.Time `json:"expected"`
+}
+
+// Record is everything known about a single journey arriving at the stop.
+type Record struct {
+	OperationDate string    `json:"operation_date"`
+	JourneyNumber int       `json:"journey"`
+	Line          string    `json:"line"`
+	Destination   string    `json:"destination"`
+	Target        time.Time `json:"target"`
+
+	// Updates are the successive ExpectedArrivalTimes, oldest first.
+	Updates []Update `json:"updates"`
+
+	// Actual is when the bus arrived, zero when that was not seen: it is the
+	// ExpectedArrivalTime once ARRIVED or PASSED, or the last one when the pass
+	// disappeared within arrivalSlack of it.
+	Actual time.Time `json:"actual"`
+}
+
+// Arrived reports whether the actual arrival time is known.
+func (r Record) Arrived() bool {
+	return !r.Actual.IsZero()
+}
+
+// Delay is the actual minus the planned arrival.
+func (r Record) Delay() time.Duration {
+	return r.Actual.Sub(r.Target)
+}
+
+// Load reads the history file at path into records, ordered by planned arrival.
+func Load(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		records = map[string]*Record{}
+		lines   = 0
+	)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines++
+
+		var e event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("could not parse history %v line %d: %v", path, lines, err)
+		}
+
+		k := e.Key()
+		r, ok := records[k]
+		if !ok {
+			r = &Record{
+				OperationDate: e.OperationDate,
+				JourneyNumber: e.JourneyNumber,
+				Line:          e.Line,
+				Destination:   e.Destination,
+			}
+			records[k] = r
+		}
+		apply(r, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Record, 0, len(records))
+	for _, r := range records {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Target.Before(out[j].Target)
+	})
+
+	return out, nil
+}
+
+// apply adds the event to the record of its journey.
+func apply(r *Record, e event) {
+	if r.Arrived() {
+		return
+	}
+	r.Target = e.Target
+
+	switch e.Status {
+	case StatusArrived, StatusPassed:
+		r.Actual = e.Expected
+	case StatusGone:
+		if len(r.Updates) > 0 && e.At.After(e.Expected.Add(-arrivalSlack)) {
+			r.Actual = r.Updates[len(r.Updates)-1].Expected
+		}
+	default:
+		if n := len(r.Updates); n == 0 || !r.Updates[n-1].Expected.Equal(e.Expected) {
+			r.Updates = append(r.Updates, Update{At: e.At, Expected: e.Expected})
+		}
+	}
+}
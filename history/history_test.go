@@ -0,0 +1,114 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	at := func(hm string) time.Time {
+		v, _ := time.Parse("15:04", hm)
+		return time.Date(2019, 1, 2, v.Hour(), v.Minute(), 0, 0, time.UTC)
+	}
+	pass := func(journey int, status string, expected string) Pass {
+		return Pass{
+			OperationDate: "2019-01-02",
+			JourneyNumber: journey,
+			Line:          "35",
+			Destination:   "OLPP",
+			Status:        status,
+			Target:        at("08:10"),
+			Expected:      at(expected),
+		}
+	}
+
+	r, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Record(at("08:00"), []Pass{pass(1, "PLANNED", "08:10"), pass(2, "PLANNED", "08:10")}))
+	assert.NoError(t, r.Record(at("08:01"), []Pass{pass(1, "PLANNED", "08:10"), pass(2, "PLANNED", "08:10")}))
+	assert.NoError(t, r.Record(at("08:05"), []Pass{pass(1, "DRIVING", "08:12"), pass(2, "DRIVING", "08:20")}))
+	assert.NoError(t, r.Record(at("08:12"), []Pass{pass(1, "ARRIVED", "08:13"), pass(2, "DRIVING", "08:20")}))
+	assert.NoError(t, r.Record(at("08:14"), nil)) // 2 disappears long before it is due
+	assert.NoError(t, r.Close())
+
+	// Only changes are written: nothing at 08:01, and both gone at 08:14.
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 7, strings.Count(string(b), "\n"))
+
+	records, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	byJourney := map[int]Record{}
+	for _, rec := range records {
+		byJourney[rec.JourneyNumber] = rec
+	}
+
+	one := byJourney[1]
+	assert.Equal(t, []Update{{at("08:00"), at("08:10")}, {at("08:05"), at("08:12")}}, one.Updates)
+	assert.Equal(t, at("08:13"), one.Actual)
+	assert.Equal(t, time.Minute*3, one.Delay())
+
+	two := byJourney[2]
+	assert.False(t, two.Arrived())
+
+	stats := Report(records, time.UTC)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, 8, stats[0].Hour)
+	assert.Equal(t, AllHours, stats[1].Hour)
+
+	s := stats[1]
+	assert.Equal(t, 2, s.Passes)
+	assert.Equal(t, 1, s.Arrived)
+	assert.Equal(t, 1.0, s.Punctuality())
+	assert.Equal(t, time.Minute*3, s.Delay)
+	assert.Equal(t, time.Minute*2, s.PredictionError) // (3m + 1m) / 2
+}
+
+func TestCorrection(t *testing.T) {
+	// Every weekday morning, buses predicted 5 minutes out arrive 2 minutes late.
+	var records []Record
+	for day := 1; day <= 10; day++ {
+		target := time.Date(2019, 1, day, 8, 10, 0, 0, time.UTC)
+		records = append(records, Record{
+			OperationDate: target.Format("2006-01-02"),
+			JourneyNumber: 1,
+			Line:          "35",
+			Target:        target,
+			Updates:       []Update{{At: target.Add(-time.Minute * 4), Expected: target}},
+			Actual:        target.Add(time.Minute * 2),
+		})
+	}
+
+	m := Learn(records[:6], time.UTC)
+	at := time.Date(2019, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	got, ok := m.Correct("35", at.Add(time.Minute*4), at)
+	assert.True(t, ok)
+	assert.Equal(t, at.Add(time.Minute*6), got)
+
+	_, ok = m.Correct("35", at.Add(time.Minute*30), at) // nothing learned this far out
+	assert.False(t, ok)
+	_, ok = m.Correct("15", at.Add(time.Minute*4), at)
+	assert.False(t, ok)
+
+	acc := Evaluate(records[:6], records[6:], time.UTC)
+	all := acc[len(acc)-1]
+	assert.Equal(t, "all", all.Horizon)
+	assert.Equal(t, 4, all.Predictions)
+	assert.Equal(t, time.Minute*2, all.Raw)
+	assert.Equal(t, time.Duration(0), all.Corrected)
+	assert.Equal(t, "2m-5m", acc[1].Horizon)
+	assert.Equal(t, 4, acc[1].Improved)
+}
@@ -0,0 +1,155 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// A bus is on time when it arrives at most Early before
+// or Late after its planned arrival.
+const (
+	Early = time.Minute
+	Late  = time.Minute * 3
+)
+
+// AllHours is the Hour of the Stats covering a whole line.
+const AllHours = -1
+
+// Stats sums up the arrivals of a line within an hour of the day.
+type Stats struct {
+	Line string
+	Hour int // of the planned arrival, AllHours for the whole line
+
+	Passes  int // journeys seen
+	Arrived int // journeys of which the actual arrival is known
+	OnTime  int
+
+	// Delay is the mean actual minus planned arrival.
+	Delay time.Duration
+
+	// PredictionError is the mean absolute difference between
+	// the ExpectedArrivalTimes and the actual arrival.
+	PredictionError time.Duration
+
+	delay       time.Duration
+	predError   time.Duration
+	predictions int
+}
+
+// Punctuality is the share of arrived journeys that were on time, 0..1.
+func (s Stats) Punctuality() float64 {
+	if s.Arrived == 0 {
+		return 0
+	}
+	return float64(s.OnTime) / float64(s.Arrived)
+}
+
+// Report computes the Stats per line and per hour of the day in loc,
+// followed by the Stats of each line as a whole.
+func Report(records []Record, loc *time.Location) []Stats {
+	type key struct {
+		line string
+		hour int
+	}
+	stats := map[key]*Stats{}
+	add := func(k key, r Record) {
+		s, ok := stats[k]
+		if !ok {
+			s = &Stats{Line: k.line, Hour: k.hour}
+			stats[k] = s
+		}
+		s.add(r)
+	}
+
+	for _, r := range records {
+		add(key{r.Line, r.Target.In(loc).Hour()}, r)
+		add(key{r.Line, AllHours}, r)
+	}
+
+	out := make([]Stats, 0, len(stats))
+	for _, s := range stats {
+		if s.Arrived > 0 {
+			s.Delay = s.delay / time.Duration(s.Arrived)
+		}
+		if s.predictions > 0 {
+			s.PredictionError = s.predError / time.Duration(s.predictions)
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Line != out[j].Line {
+			return out[i].Line < out[j].Line
+		}
+		// The whole line goes last.
+		return uint(out[i].Hour) < uint(out[j].Hour)
+	})
+
+	return out
+}
+
+func (s *Stats) add(r Record) {
+	s.Passes++
+	if !r.Arrived() {
+		return
+	}
+
+	s.Arrived++
+	d := r.Delay()
+	s.delay += d
+	if d >= -Early && d <= Late {
+		s.OnTime++
+	}
+
+	for _, u := range r.Updates {
+		if !u.At.Before(r.Actual) {
+			continue
+		}
+		s.predError += abs(u.Expected.Sub(r.Actual))
+		s.predictions++
+	}
+}
+
+// Print writes the stats as a table.
+func Print(w io.Writer, stats []Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "line\thour\tpasses\tarrived\ton time\tavg delay\tprediction error\t")
+	for _, s := range stats {
+		hour := "all"
+		if s.Hour != AllHours {
+			hour = fmt.Sprintf("%02d:00", s.Hour)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%d\t%d\t%.0f%%\t%v\t%v\t\n",
+			s.Line, hour, s.Passes, s.Arrived, s.Punctuality()*100,
+			s.Delay.Round(time.Second), s.PredictionError.Round(time.Second),
+		)
+	}
+
+	return tw.Flush()
+}
+
+// PrintAccuracy writes the accuracy of the predictions as a table.
+func PrintAccuracy(w io.Writer, acc []Accuracy) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "horizon\tpredictions\traw error\tcorrected error\timproved\t")
+	for _, a := range acc {
+		improved := 0.0
+		if a.Predictions > 0 {
+			improved = float64(a.Improved) / float64(a.Predictions) * 100
+		}
+		fmt.Fprintf(tw, "%v\t%d\t%v\t%v\t%.0f%%\t\n",
+			a.Horizon, a.Predictions, a.Raw.Round(time.Second), a.Corrected.Round(time.Second), improved,
+		)
+	}
+
+	return tw.Flush()
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/mapsgvbnl"
+)
+
+// live keeps the buses heard on the GVB maps websocket, by watch and journey,
+// to be shown along with the ones fetched from OVAPI. A nil live keeps none.
+type live struct {
+	mu      sync.Mutex
+	buses   map[string]arrivals.Bus
+	changed chan struct{} // gets a value when a bus came in
+}
+
+func newLive() *live {
+	return &live{
+		buses:   map[string]arrivals.Bus{},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// listen keeps the buses of interest to the watches of wc until ctx is done.
+func (l *live) listen(ctx context.Context, wc *mapsgvbnl.Client) {
+	for bus := range wc.ConnectAndListen(ctx) {
+		if bus.LastUpdateTimestamp.IsZero() {
+			bus.LastUpdateTimestamp = wc.Clock.Now()
+		}
+		l.add(bus)
+	}
+}
+
+// add keeps bus, replacing what was heard of its journey before.
+func (l *live) add(bus arrivals.Bus) {
+	l.mu.Lock()
+	l.buses[liveKey(bus)] = bus
+	l.mu.Unlock()
+
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+}
+
+// liveKey tells the passes of the watches apart.
+func liveKey(bus arrivals.Bus) string {
+	if bus.Journey != "" {
+		return bus.Watch + " " + bus.Journey
+	}
+	return bus.Watch + " " + bus.LineNumber + " " + bus.PlannedArrivalTime.Format(time.RFC3339)
+}
+
+// updates gets a value when a bus came in.
+func (l *live) updates() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.changed
+}
+
+// reset forgets all buses, e.g. when the websocket is stopped.
+func (l *live) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buses = map[string]arrivals.Bus{}
+}
+
+// merge returns buses with the live ones of the watches of cfg at now, ordered
+// by when to leave for them. A bus of the same watch and line planned at the same
+// time takes the ETA and stops to go heard last, the others are added. Buses no
+// longer of interest to their watch are left out, and forgotten once they have arrived.
+func (l *live) merge(buses []arrivals.Bus, cfg config.Config, now time.Time) []arrivals.Bus {
+	if l == nil {
+		return buses
+	}
+
+	filters := map[string]arrivals.Filter{}
+	for _, w := range cfg.Watchlist() {
+		filters[w.Name] = filterOf(w, cfg)
+	}
+
+	l.mu.Lock()
+	heard := make([]arrivals.Bus, 0, len(l.buses))
+	for key, bus := range l.buses {
+		if bus.CompiledArrivalTime.Before(now) {
+			delete(l.buses, key)
+			continue
+		}
+		if !cfg.StopsAway {
+			bus.Approach = nil
+		}
+		heard = append(heard, bus)
+	}
+	l.mu.Unlock()
+
+	merged := append([]arrivals.Bus(nil), buses...)
+	for _, bus := range heard {
+		same := -1
+		for i, b := range merged {
+			if b.Watch == bus.Watch && b.LineNumber == bus.LineNumber && b.PlannedArrivalTime.Equal(bus.PlannedArrivalTime) {
+				same = i
+				break
+			}
+		}
+		switch {
+		case same < 0:
+			merged = append(merged, bus)
+		case bus.LastUpdateTimestamp.After(merged[same].LastUpdateTimestamp):
+			b := &merged[same]
+			b.CompiledArrivalTime, b.DelaySeconds, b.LastUpdateTimestamp = bus.CompiledArrivalTime, bus.DelaySeconds, bus.LastUpdateTimestamp
+			if bus.Approach != nil {
+				b.Approach = bus.Approach
+			}
+		}
+	}
+
+	kept := merged[:0]
+	for _, bus := range merged {
+		if f, ok := filters[bus.Watch]; ok && f.Drop(bus, now) == "" {
+			kept = append(kept, bus)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Leave().Before(kept[j].Leave())
+	})
+	return kept
+}
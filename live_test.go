@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+func TestLiveMerge(t *testing.T) {
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default()
+	cfg.Watches = []config.Watch{
+		{Name: "bus", StopAreaCode: "01346", Lines: []string{"35"}},
+		{Name: "tram", StopAreaCode: "08174", WalkTime: config.Duration{Duration: time.Minute * 5}},
+	}
+	bus := func(watch, line string, planned, eta, updated int) arrivals.Bus {
+		return arrivals.Bus{
+			Watch:               watch,
+			LineNumber:          line,
+			PlannedArrivalTime:  now.Add(time.Minute * time.Duration(planned)),
+			CompiledArrivalTime: now.Add(time.Minute * time.Duration(eta)),
+			LastUpdateTimestamp: now.Add(time.Second * time.Duration(updated)),
+		}
+	}
+
+	var l *live
+	polled := []arrivals.Bus{bus("bus", "35", 10, 10, -30), bus("tram", "2", 12, 12, -30)}
+	assert.Equal(t, polled, l.merge(polled, cfg, now), "without the websocket")
+	assert.Nil(t, l.updates())
+
+	l = newLive()
+	late := bus("bus", "35", 10, 13, 0) // heard after it was polled
+	late.Approach = &arrivals.Approach{Stops: 6}
+	l.add(late)
+	l.add(bus("tram", "2", 12, 11, -60)) // heard before it was polled
+	l.add(bus("tram", "5", 8, 8, 0))     // not polled yet
+	l.add(bus("tram", "5", 3, 3, 0))     // can not be caught
+	l.add(bus("tram", "5", 1, -1, 0))    // gone
+	l.add(bus("ferry", "901", 5, 6, 0))  // of a watch no longer there
+	select {
+	case <-l.updates():
+	default:
+		t.Error("no update")
+	}
+
+	var got []string
+	for _, b := range l.merge(polled, cfg, now) {
+		got = append(got, b.Watch+" "+b.LineNumber+" "+b.CompiledArrivalTime.Sub(now).String())
+	}
+	assert.Equal(t, []string{"tram 5 8m0s", "tram 2 12m0s", "bus 35 13m0s"}, got)
+	assert.Nil(t, l.merge(polled, cfg, now)[2].Approach, "without stops_away")
+	cfg.StopsAway = true
+	assert.Equal(t, late.Approach, l.merge(polled, cfg, now)[2].Approach)
+	assert.Equal(t, now.Add(time.Minute*10), polled[0].CompiledArrivalTime, "polled buses are not changed")
+	assert.Len(t, l.buses, 5, "arrived buses are forgotten")
+
+	l.reset()
+	assert.Equal(t, polled, l.merge(polled, cfg, now))
+}
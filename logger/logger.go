@@ -0,0 +1,215 @@
+// Package logger writes levelled, structured log lines as logfmt or JSON.
+//
+//	log := logger.New(os.Stderr, logger.FormatLogfmt, logger.Info).With("component", "ovapi")
+//	log.Info("fetched departures", "stop", "01346", "passes", 12)
+//
+// A nil *Logger discards everything, so packages can take one optionally.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a log line.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return Info, fmt.Errorf("log level must be debug, info, warn or error, passed: %v", s)
+}
+
+// Formats of a log line.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Logger writes log lines with a fixed set of fields.
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// output is shared by a Logger and everything derived from it with With.
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	level  Level
+	now    func() time.Time
+}
+
+// New returns a Logger writing lines of at least level to w.
+func New(w io.Writer, format string, level Level) *Logger {
+	return &Logger{
+		out: &output{
+			w:      w,
+			format: format,
+			level:  level,
+			now:    time.Now,
+		},
+	}
+}
+
+// With returns a Logger adding the key value pairs to every line,
+// e.g. With("component", "ovapi", "stop", "01346").
+func (l *Logger) With(kv ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{out: l.out, fields: fields}
+}
+
+// SetLevel changes the level of the Logger and all Loggers derived from it.
+func (l *Logger) SetLevel(level Level) {
+	if l == nil {
+		return
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.level = level
+}
+
+// Enabled reports whether lines of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil {
+		return false
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return level >= l.out.level
+}
+
+// Debug logs msg with the key value pairs at debug level.
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(Debug, msg, kv) }
+
+// Info logs msg with the key value pairs at info level.
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(Info, msg, kv) }
+
+// Warn logs msg with the key value pairs at warn level.
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(Warn, msg, kv) }
+
+// Error logs msg with the key value pairs at error level.
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(Error, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	pairs := append([]interface{}{
+		"time", l.out.now().Format(time.RFC3339),
+		"level", level.String(),
+		"msg", msg,
+	}, l.fields...)
+	pairs = append(pairs, kv...)
+	if len(pairs)%2 != 0 {
+		pairs = append(pairs, "MISSING")
+	}
+
+	var line string
+	if l.out.format == FormatJSON {
+		line = formatJSON(pairs)
+	} else {
+		line = formatLogfmt(pairs)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	io.WriteString(l.out.w, line+"\n")
+}
+
+func formatLogfmt(pairs []interface{}) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprint(pairs[i])+"="+quote(value(pairs[i+1])))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatJSON(pairs []interface{}) string {
+	m := map[string]interface{}{}
+	keys := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		k := fmt.Sprint(pairs[i])
+		if _, ok := m[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		v := pairs[i+1]
+		switch v.(type) {
+		case error, fmt.Stringer, time.Duration:
+			v = value(v)
+		}
+		m[k] = v
+	}
+
+	// Keep time, level and msg in front, the rest sorted.
+	sort.Strings(keys[3:])
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kb, _ := json.Marshal(k)
+		vb, err := json.Marshal(m[k])
+		if err != nil {
+			vb, _ = json.Marshal(fmt.Sprint(m[k]))
+		}
+		parts = append(parts, string(kb)+":"+string(vb))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func value(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTest(format string, level Level) (*Logger, *bytes.Buffer) {
+	var b bytes.Buffer
+	l := New(&b, format, level)
+	l.out.now = func() time.Time { return time.Date(2019, 1, 2, 8, 30, 0, 0, time.UTC) }
+	return l, &b
+}
+
+func TestLogfmt(t *testing.T) {
+	l, b := newTest(FormatLogfmt, Info)
+	l.With("source", "ovapi").Info("could not fetch", "err", errors.New("no route to host"), "took", time.Second)
+
+	assert.Equal(t, `time=2019-01-02T08:30:00Z level=info msg="could not fetch" source=ovapi err="no route to host" took=1s`+"\n", b.String())
+}
+
+func TestJSON(t *testing.T) {
+	l, b := newTest(FormatJSON, Debug)
+	l.With("line", "35").Debug("filtered pass", "reason", "past", "journey", 123)
+
+	assert.Equal(t, `{"time":"2019-01-02T08:30:00Z","level":"debug","msg":"filtered pass","journey":123,"line":"35","reason":"past"}`+"\n", b.String())
+}
+
+func TestLevel(t *testing.T) {
+	l, b := newTest(FormatLogfmt, Warn)
+	l.Debug("hidden")
+	l.Info("hidden")
+	assert.Empty(t, b.String())
+
+	l.With("component", "http").SetLevel(Debug)
+	l.Debug("shown")
+	assert.Contains(t, b.String(), "msg=shown")
+
+	var nl *Logger
+	nl.With("a", 1).Error("discarded")
+
+	lv, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, Warn, lv)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
@@ -1,494 +1,148 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
 	"os"
-	"os/signal"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/mapsgvbnl"
 	"gitlab.org/go-unicord-phat-lucian/ovapi"
-	"gitlab.org/go-unicord-phat-lucian/unicornphat"
 )
 
-const (
-	busLineNumber      = "35"
-	busDestinationCode = "OLPP"
-	secondsToPullOV    = 60
-	minutesFilterETA   = 35
-)
-
-var (
-	mapPanel0 = map[int]func(c *unicorn.Client, r, g, b uint){
-		0: draw0Panel0,
-		1: draw1Panel0,
-		2: draw2Panel0,
-		3: draw3Panel0,
-		4: draw4Panel0,
-		5: draw5Panel0,
-		6: draw6Panel0,
-		7: draw7Panel0,
-		8: draw8Panel0,
-		9: draw9Panel0,
-	}
-	mapPanel1 = map[int]func(c *unicorn.Client, r, g, b uint){
-		0: draw0Panel1,
-		1: draw1Panel1,
-		2: draw2Panel1,
-		3: draw3Panel1,
-		4: draw4Panel1,
-		5: draw5Panel1,
-		6: draw6Panel1,
-		7: draw7Panel1,
-		8: draw8Panel1,
-		9: draw9Panel1,
+// filterOf returns the filter of w, leaving out buses after max_eta.
+func filterOf(w config.Watch, cfg config.Config) arrivals.Filter {
+	return arrivals.Filter{
+		Lines:               w.Lines,
+		Direction:           w.Direction,
+		TimingPoints:        w.TimingPoints,
+		UserStops:           w.UserStops,
+		Destinations:        w.Destinations,
+		ExcludeDestinations: w.ExcludeDestinations,
+		TransportTypes:      w.TransportTypes,
+		Wheelchair:          w.Wheelchair,
+		MaxETA:              cfg.MaxETA.Duration,
+		WalkTime:            w.WalkTime.Duration,
 	}
-)
-
-type BusOfInterest struct {
-	LineNumber           string    `json:"line_number"`
-	TripStatus           string    `json:"trip_status"`
-	FinalDestinationName string    `json:"final_destination_name"`
-	FinalDestinationCode string    `json:"final_destination_code"`
-	CompiledArrivalTime  time.Time `json:"compiled_arrival_time"` // compiled ETA
-	PlannedArrivalTime   time.Time `json:"planned_arrival_time"`  // scheduled ETA
-	LastUpdateTimestamp  time.Time `json:"last_update_timestamp"`
 }
 
-func transferOVAPItoBusOfInterest(ov *ovapi.OVAPIResponse) []BusOfInterest {
-	var buses []BusOfInterest
-	timeLayout := "2006-01-02T15:04:05-07:00"
-	localTime := time.Now()
-
-	// Process and filter each bus timetable.
-	for _, pass := range ov.Station.DirectionOlofPalmeplein.Passes {
-		if pass.LinePublicNumber != busLineNumber {
-			//fmt.Printf("Filtered bus line number (%v)\n", pass.LinePublicNumber)
-			continue
-		}
-
-		if pass.DestinationCode != busDestinationCode {
-			fmt.Printf("Filtered bus destination code (%v)\n", pass.DestinationCode)
-			continue
-		}
-
-		arrivalTime, err := time.Parse(timeLayout, pass.ExpectedArrivalTime+"+01:00")
-		if err != nil {
-			fmt.Printf("\nUnable to parse arrival time for pass (%#v)\n\n", pass)
-			continue
-		}
-
-		/*
-			Important. This constraints the number of buses to be displayed
-		*/
-		if arrivalTime.Sub(localTime).Minutes() > minutesFilterETA {
-			//h, m, s := arrivalTime.Clock()
-			//fmt.Printf("Filtered bus too far in the future %v:%v:%v (%v)\n", h, m, s, arrivalTime.Sub(localTime))
-			continue
+// websocketWatches returns what to follow on the GVB maps websocket for the watches:
+// the passes at each of their user stops, or at their stop area, which GVB numbers
+// like its stops.
+func websocketWatches(cfg config.Config) []mapsgvbnl.Watch {
+	var watches []mapsgvbnl.Watch
+	for _, w := range cfg.Watchlist() {
+		stops := w.UserStops
+		if len(stops) == 0 {
+			stops = []string{w.StopAreaCode}
 		}
-
-		// Past events.
-		if arrivalTime.Sub(localTime) < 0 {
-			//h, m, s := arrivalTime.Clock()
-			//fmt.Printf("Filtered bus in the past %v:%v:%v (%v)\n", h, m, s, arrivalTime.Sub(localTime))
-			continue
+		for _, stop := range stops {
+			watches = append(watches, mapsgvbnl.Watch{
+				Name:         w.Name,
+				Stop:         stop,
+				Filter:       filterOf(w, cfg),
+				Destinations: cfg.Schedule.Destinations,
+			})
 		}
+	}
+	return watches
+}
 
-		// Last update timestamp.
-		pass.LastUpdateTimeStamp = strings.Replace(pass.LastUpdateTimeStamp, "+0100", "+01:00", -1)
-		lastUpdateTimestamp, err := time.Parse(timeLayout, pass.LastUpdateTimeStamp)
-		if err != nil {
-			fmt.Printf("Skipped faulty pass LastUpdateTimeStamp (%v): %v\n", pass.LastUpdateTimeStamp, err)
-			continue
-		}
+// fromOVAPI keeps the passes of d selected by w arriving within max_eta.
+// Every pass left out is counted and logged with the reason.
+func fromOVAPI(d ovapi.Departures, w config.Watch, cfg config.Config, now time.Time, log *logger.Logger) []arrivals.Bus {
+	passes := d.Passes()
+	passesReceived.Add(float64(len(passes)))
 
-		// Planned time arrival.
-		plannedArrivalTime, err := time.Parse(timeLayout, pass.TargetArrivalTime+"+01:00")
-		if err != nil {
-			fmt.Printf("Skipped faulty pass TargetArrivalTime (%v): %v\n", pass.TargetArrivalTime, err)
+	buses, dropped := arrivals.FromOVAPI(d, filterOf(w, cfg), now)
+	for _, d := range dropped {
+		passesFiltered.Inc(d.Reason)
+		log := log.With("line", d.Line, "destination", d.Destination, "journey", d.Journey)
+		if d.Err != nil {
+			log.Warn("filtered pass", "reason", d.Reason, "err", d.Err)
 			continue
 		}
-
-		var bus BusOfInterest
-		bus.LineNumber = pass.LinePublicNumber
-		bus.TripStatus = pass.TripStopStatus
-		bus.FinalDestinationName = pass.DestinationName50
-		bus.FinalDestinationCode = pass.DestinationCode
-
-		bus.LastUpdateTimestamp = lastUpdateTimestamp
-		bus.CompiledArrivalTime = arrivalTime
-		bus.PlannedArrivalTime = plannedArrivalTime
-
-		buses = append(buses, bus)
-	}
-
-	return buses
-}
-
-func pullOV(out chan []int) {
-	ov, err := ovapi.RequestDataFromOV()
-	if err != nil {
-		log.Fatal(err)
+		log.Debug("filtered pass", "reason", d.Reason, "arrival", d.Arrival.Format("15:04:05"), "eta", d.Arrival.Sub(now))
 	}
-
-	frames := make([]int, 0)
-	buses := transferOVAPItoBusOfInterest(ov)
-	for _, bus := range buses {
-		s := fmt.Sprintf("> Bus (%v) is (%v) w/ ETA: (%v) aka (%v), offset (%v)",
-			bus.LineNumber,
-			bus.TripStatus,
-			bus.CompiledArrivalTime,
-			bus.CompiledArrivalTime.Sub(time.Now()),
-			bus.PlannedArrivalTime.Sub(bus.CompiledArrivalTime),
-		)
-		fmt.Println(s)
-
-		min := bus.CompiledArrivalTime.Sub(time.Now()).Minutes()
-		frames = append(frames, int(min))
+	for i := range buses {
+		buses[i].Watch = w.Name
 	}
 
-	out <- frames
+	return buses
 }
 
-func sendToDisplay(num int, c *unicorn.Client) {
-	c.Clear()
-
-	switch {
-	case num <= 3:
-		mapPanel0[num](c, 255, 0, 0) // red
-	case num > 3 && num <= 5:
-		mapPanel0[num](c, 230, 150, 0) // orange
-	case num > 5 && num < 10:
-		mapPanel1[num](c, 0, 255, 0) // green. Sweet spot.
-	case num >= 10:
-		s := strconv.Itoa(num)
-		firstNumStr := s[:1]
-		SecondNumStr := s[1:]
-		firstNumInt, _ := strconv.Atoi(firstNumStr)
-		SecondNumInt, _ := strconv.Atoi(SecondNumStr)
-		mapPanel0[int(firstNumInt)](c, 255, 255, 255)
-		mapPanel1[int(SecondNumInt)](c, 255, 255, 255)
-	default:
-		drawExclamationMark(c, 255, 0, 0)
+// keep reports whether bus is of interest to w at now, for sources other than OVAPI.
+// Buses left out are counted and logged at debug level.
+func keep(bus arrivals.Bus, w config.Watch, cfg config.Config, now time.Time, log *logger.Logger) bool {
+	reason := filterOf(w, cfg).Drop(bus, now)
+	if reason == "" {
+		return true
 	}
 
-	c.Show()
+	passesFiltered.Inc(reason)
+	log.Debug("filtered pass", "reason", reason, "arrival", bus.CompiledArrivalTime.Format("15:04:05"), "eta", bus.CompiledArrivalTime.Sub(now))
+	return false
 }
 
 func main() {
-	log.Println("Starting up...")
-	dataChan := make(chan []int)
-	go func() {
-		for {
-			pullOV(dataChan)
-			time.Sleep(time.Second * secondsToPullOV)
+	configPath := flag.String("config", "", "path to a JSON config file, defaults are used if empty")
+	flag.Usage = usage
+	flag.Parse()
+
+	cfg := config.Default()
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-	}()
-
-	fmt.Println("Starting unicorn client...")
-	c := unicorn.NewClient(false, "")
-	if err := c.Connect(); err != nil {
-		fmt.Println(err)
-		return
 	}
 
-	pixels := [64]unicorn.Pixel{}
-	for i := range pixels {
-		pixels[i] = unicorn.Pixel{
-			R: 0,
-			G: 0,
-			B: 0,
-		}
+	cmd, args := "run", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
 	}
 
-	c.SetBrightness(10)
-	c.SetAllPixels(pixels)
-	c.Show()
-	time.Sleep(time.Second * 2)
-	c.Clear()
-	log.Println("Display init OK. Waiting for input...")
-
-	go func() {
-		for {
-			minutes := <-dataChan
-			sort.Ints(minutes)
-			go func() {
-				ts := time.Now()
-				for {
-					for _, item := range minutes {
-						// Kill goroutine before the new call is made.
-						if time.Since(ts).Seconds() >= secondsToPullOV-1 {
-							log.Println("Closed. Waiting for new data.")
-							return
-						}
-
-						c.Clear()
-						sendToDisplay(item, c)
-						time.Sleep(time.Second * 2)
-					}
-				}
-			}()
-		}
-	}()
-
-	// Block and clear display on closing down.
-	ch := make(chan os.Signal)
-	signal.Notify(ch, os.Interrupt)
-	signal.Notify(ch, os.Kill)
-	for {
-		<-ch
-		c.Clear()
-		os.Exit(0)
+	switch cmd {
+	case "run":
+		os.Exit(run(cfg, *configPath, args))
+	case "once":
+		os.Exit(once(cfg, args))
+	case "list-lines":
+		os.Exit(listLines(cfg, args))
+	case "simulate":
+		os.Exit(simulate(cfg, args))
+	case "test-display":
+		os.Exit(testDisplay(cfg, args))
+	case "report":
+		os.Exit(report(cfg, args))
+	case "evaluate":
+		os.Exit(evaluate(cfg, args))
+	case "stops":
+		os.Exit(stops(cfg, args))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %v\n\n", cmd)
+		flag.Usage()
+		os.Exit(2)
 	}
 }
 
-func drawExclamationMark(c *unicorn.Client, r, g, b uint) {
-	for i := 0; i <= 7; i++ {
-		if i == 5 {
-			c.SetPixel(0, uint(i), 0, 0, 0)
-		} else {
-			if err := c.SetPixel(0, uint(i), r, g, b); err != nil {
-				log.Fatalf("Error setting pixel: %v", err)
-			}
-		}
-	}
+// start runs fn in its own goroutine. The returned func cancels
+// the context passed to fn and waits for fn to return.
+func start(fn func(ctx context.Context)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
 
-	for j := 7; j >= 0; j-- {
-		if j == 2 {
-			c.SetPixel(1, uint(j), 0, 0, 0)
-		} else {
-			if err := c.SetPixel(1, uint(j), r, g, b); err != nil {
-				log.Fatalf("Error setting pixel: %v", err)
-			}
-		}
+	return func() {
+		cancel()
+		<-done
 	}
 }
-
-func px(c *unicorn.Client, x, y, r, g, b uint) {
-	c.SetPixel(uint(x), uint(y), r, g, b)
-}
-
-func draw0Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 7, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 0, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw0Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 2, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw1Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 6, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 2, 1, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 0, 1, r, g, b)
-}
-
-func draw1Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 1, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 6, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 0, 6, r, g, b)
-}
-
-func draw2Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 2, 0, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 0, 0, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw2Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw3Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 2, 1, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 2, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 0, r, g, b)
-}
-
-func draw3Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 6, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw4Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 2, 1, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw4Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 6, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw5Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 0, 0, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw5Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw6Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 1, 7, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 0, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw6Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 1, 2, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw7Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 0, 0, r, g, b)
-}
-
-func draw7Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 0, 5, r, g, b)
-}
-
-func draw8Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 7, r, g, b)
-	px(c, 1, 6, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 0, r, g, b)
-	px(c, 0, 1, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw8Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 2, r, g, b)
-	px(c, 1, 1, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 5, r, g, b)
-	px(c, 0, 6, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
-
-func draw9Panel0(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 7, r, g, b)
-	px(c, 3, 6, r, g, b)
-	px(c, 3, 5, r, g, b)
-	px(c, 2, 0, r, g, b)
-	px(c, 2, 1, r, g, b)
-	px(c, 2, 2, r, g, b)
-	px(c, 1, 5, r, g, b)
-	px(c, 0, 2, r, g, b)
-}
-
-func draw9Panel1(c *unicorn.Client, r, g, b uint) {
-	px(c, 3, 2, r, g, b)
-	px(c, 3, 1, r, g, b)
-	px(c, 3, 0, r, g, b)
-	px(c, 2, 5, r, g, b)
-	px(c, 2, 6, r, g, b)
-	px(c, 2, 7, r, g, b)
-	px(c, 1, 0, r, g, b)
-	px(c, 0, 7, r, g, b)
-}
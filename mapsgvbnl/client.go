@@ -1,19 +1,35 @@
 package mapsgvbnl
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/metrics"
+)
+
+var (
+	connected = metrics.NewGauge("websocket_connected",
+		"1 while connected to the GVB maps websocket.")
+	reconnects = metrics.NewCounter("websocket_reconnects_total",
+		"Reconnects to the GVB maps websocket after the connection dropped.")
+	messages = metrics.NewCounter("websocket_messages_total",
+		"Messages received from the GVB maps websocket.")
 )
 
 // WebsocketMessage defines the structure of a GVB websocket json.
 type WebsocketMessage struct {
+	Stop string `json:"-"` // user stop code of the subscription it came in on, e.g. 01346
+
 	Trip struct {
 		ID            string `json:"id,omitempty"`
 		Number        string `json:"number,omitempty"`
@@ -44,138 +60,406 @@ type WebsocketMessage struct {
 		Destination string `json:"destination,omitempty"`
 	} `json:"journey,omitempty"`
 
-	Calls []struct {
-		StopCode           string     `json:"stopCode,omitempty"`
-		StopName           string     `json:"stopName,omitempty"`
-		CallOrder          int        `json:"callOrder,omitempty"`
-		Status             string     `json:"status,omitempty"`
-		PlannedArrivalAt   string     `json:"plannedArrivalAt,omitempty"`
-		PlannedDepartureAt string     `json:"plannedDepartureAt,omitempty"`
-		Delay              int        `json:"delay,omitempty"`
-		LiveArrivalAt      string     `json:"liveArrivalAt,omitempty"`
-		LiveDepartureAt    string     `json:"liveDepartureAt,omitempty"`
-		IsExtrapolated     bool       `json:"isExtrapolated,omitempty"`
-		LastUpdateAt       *time.Time `json:"lastUpdateAt,omitempty"`
-	} `json:"calls,omitempty"`
+	Calls []Call `json:"calls,omitempty"`
 
 	Time int `json:"time,omitempty"`
 }
 
-func cleanJSON(b []byte) []byte {
-	str := string(b)
-	str = strings.Replace(str, `\`, "", -1)
-	str = strings.Replace(str, `[8,"/stops/01346","`, "", 1)
-	str = strings.Replace(str, `}"]`, "}", 1)
+// Call is a stop the trip calls at.
+type Call struct {
+	StopCode           string     `json:"stopCode,omitempty"`
+	StopName           string     `json:"stopName,omitempty"`
+	CallOrder          int        `json:"callOrder,omitempty"`
+	Status             string     `json:"status,omitempty"`
+	PlannedArrivalAt   string     `json:"plannedArrivalAt,omitempty"`
+	PlannedDepartureAt string     `json:"plannedDepartureAt,omitempty"`
+	Delay              int        `json:"delay,omitempty"`
+	LiveArrivalAt      string     `json:"liveArrivalAt,omitempty"`
+	LiveDepartureAt    string     `json:"liveDepartureAt,omitempty"`
+	IsExtrapolated     bool       `json:"isExtrapolated,omitempty"`
+	LastUpdateAt       *time.Time `json:"lastUpdateAt,omitempty"`
+}
 
-	return []byte(str)
+// cleanJSON takes the message out of an event frame, e.g. `[8,"/stops/01346","{\"trip\":...}"]`,
+// and returns the stop it is about.
+func cleanJSON(b []byte) (string, []byte, error) {
+	var event []json.RawMessage
+	if err := json.Unmarshal(b, &event); err != nil {
+		return "", nil, err
+	}
+	var topic, msg string
+	if len(event) != 3 || json.Unmarshal(event[1], &topic) != nil || json.Unmarshal(event[2], &msg) != nil {
+		return "", nil, errors.New("not an event of a stop")
+	}
+	if !strings.HasPrefix(topic, stopsTopic) {
+		return "", nil, fmt.Errorf("not an event of a stop: %v", topic)
+	}
+	return strings.TrimPrefix(topic, stopsTopic), []byte(msg), nil
 }
 
-func FromClockToTime(s string) (*time.Time, error) {
+// stopsTopic is followed by a user stop code to subscribe to its passes.
+const stopsTopic = "/stops/"
+
+// amsterdam is the time zone of the clock times on the websocket.
+var amsterdam = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}()
+
+// FromClockToTime returns the time of day s, e.g. `23:45:30`, in Amsterdam that
+// is closest to now: shortly after midnight 23:59:00 is yesterday, and shortly
+// before midnight 00:01:00 is tomorrow.
+func FromClockToTime(s string, now time.Time) (*time.Time, error) {
 	strsTime := strings.Split(s, ":")
 	if len(strsTime) != 3 {
 		return nil, errors.New("fromClockToTime: need time in format `23:45:30`")
 	}
 
-	hours, err := strconv.ParseInt(strsTime[0], 10, 32)
-	if err != nil {
-		return nil, err
+	var parts [3]int
+	for i, str := range strsTime {
+		v, err := strconv.ParseInt(str, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = int(v)
 	}
 
-	mins, _ := strconv.ParseInt(strsTime[1], 10, 32)
-	if err != nil {
-		return nil, err
+	n := now.In(amsterdam)
+	t := time.Date(n.Year(), n.Month(), n.Day(), parts[0], parts[1], parts[2], 0, amsterdam)
+	switch {
+	case t.Sub(n) > time.Hour*12:
+		t = t.AddDate(0, 0, -1)
+	case n.Sub(t) > time.Hour*12:
+		t = t.AddDate(0, 0, 1)
 	}
+	return &t, nil
+}
+
+// Watch selects the passes of interest at a stop.
+type Watch struct {
+	Name   string
+	Stop   string // user stop code to subscribe to, e.g. 01346
+	Filter arrivals.Filter
 
-	secs, _ := strconv.ParseInt(strsTime[2], 10, 32)
+	// Destinations maps the destination names of the websocket, e.g. Olof Palmeplein,
+	// onto the DestinationCodes of the filter.
+	Destinations map[string]string
+}
+
+// ofInterest returns the bus of m arriving at the stop of w,
+// or why it is not of interest to w at now.
+func ofInterest(m WebsocketMessage, w Watch, now time.Time) (arrivals.Bus, string) {
+	call, ok := m.call(w.Stop)
+	if !ok {
+		return arrivals.Bus{}, arrivals.FilteredStop
+	}
+
+	// Decide which timestamp to use.
+	// Ideally we would use directly the provided "planned" time,
+	// which includes delays or advances in the schedule.
+	planned, err := FromClockToTime(call.PlannedArrivalAt, now)
 	if err != nil {
-		return nil, err
+		return arrivals.Bus{}, arrivals.FilteredParseError
+	}
+	arrival := planned
+	if call.LiveArrivalAt != "" {
+		if arrival, err = FromClockToTime(call.LiveArrivalAt, now); err != nil {
+			return arrivals.Bus{}, arrivals.FilteredParseError
+		}
 	}
 
-	loc, _ := time.LoadLocation("Europe/Amsterdam")
-	t := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), int(hours), int(mins), int(secs), time.Now().Nanosecond(), loc)
-	return &t, nil
+	bus := arrivals.Bus{
+		LineNumber:           m.Journey.LineNumber,
+		TransportType:        transportOf(m.Journey.Vehicletype),
+		TripStatus:           call.Status,
+		FinalDestinationName: m.Journey.Destination,
+		FinalDestinationCode: w.Destinations[m.Journey.Destination],
+		UserStopCode:         m.Stop,
+		CompiledArrivalTime:  *arrival,
+		PlannedArrivalTime:   *planned,
+		DelaySeconds:         int(arrival.Sub(*planned).Seconds()),
+		Watch:                w.Name,
+		WalkTime:             w.Filter.WalkTime,
+		Journey:              m.Trip.ID,
+		StopOrder:            call.CallOrder,
+	}
+	if call.LastUpdateAt != nil {
+		bus.LastUpdateTimestamp = *call.LastUpdateAt
+	}
+	if n, ok := StopsAway(m, append([]string{w.Stop}, w.Filter.TimingPoints...)...); ok {
+		bus.Approach = &arrivals.Approach{Stops: n}
+	}
+	return bus, w.Filter.Drop(bus, now)
 }
 
-func ConnectAndListen() chan WebsocketMessage {
-	log.Println("Connecting to websocket...")
-	d := websocket.Dialer{
-		EnableCompression: true,
-		HandshakeTimeout:  time.Minute * 15,
+// transportOf returns the TransportType of a vehicletype of the websocket,
+// e.g. Tram, or "" when it is not known.
+func transportOf(vehicletype string) string {
+	switch strings.ToUpper(vehicletype) {
+	case "BUS":
+		return arrivals.TransportBus
+	case "TRAM":
+		return arrivals.TransportTram
+	case "METRO":
+		return arrivals.TransportMetro
+	case "BOAT", "FERRY", "VEER", "PONT":
+		return arrivals.TransportBoat
 	}
+	return ""
+}
 
-	ws, _, err := d.Dial("wss://maps-wss.gvb.nl/", http.Header{
-		"User-Agent": []string{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36"},
-	})
-	if err != nil {
-		log.Printf("Could not connect to ws: %v", err)
+// call returns the call of m at stop, or its first one for messages
+// that do not tell the stops of their calls.
+func (m WebsocketMessage) call(stop string) (Call, bool) {
+	for _, c := range m.Calls {
+		if c.StopCode == stop {
+			return c, true
+		}
+	}
+	if len(m.Calls) > 0 && m.Calls[0].StopCode == "" {
+		return m.Calls[0], true
+	}
+	return Call{}, false
+}
+
+// StopsAway returns how many stops the bus of m still has to go to the stop
+// with one of stopCodes, e.g. its user stop and timing point code, from the order
+// of its calls. It is not known when the bus made no call yet, or does not call at the stop.
+func StopsAway(m WebsocketMessage, stopCodes ...string) (int, bool) {
+	last := m.Trip.LastCallMade.CallOrder
+	if last == 0 {
+		return 0, false
+	}
+	for _, call := range m.Calls {
+		if oneOf(call.StopCode, stopCodes) && call.CallOrder >= last {
+			return call.CallOrder - last, true
+		}
+	}
+	return 0, false
+}
+
+// oneOf reports whether s is in set.
+func oneOf(s string, set []string) bool {
+	for _, v := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Client follows the buses on the GVB maps websocket.
+type Client struct {
+	Log   *logger.Logger
+	Clock clock.Clock
+
+	// Watches are the passes followed, read when connecting.
+	Watches []Watch
+
+	// Filtered, when set, gets the reason of every pass left out by a watch,
+	// e.g. to count them like the ones of OVAPI.
+	Filtered func(reason string)
+
+	// Record, when set, gets every frame received, e.g. to capture a day.
+	Record func(frame []byte)
+
+	// Replay, when set, replaces the websocket by the frames it returns.
+	Replay func(ctx context.Context) <-chan []byte
+}
+
+// NewClient returns a websocket Client logging to log, which may be nil.
+func NewClient(log *logger.Logger) *Client {
+	return &Client{
+		Log:   log.With("source", "websocket"),
+		Clock: clock.Real,
 	}
-	defer ws.Close()
-	log.Println("Connected to websocket")
+}
 
+// ConnectAndListen keeps a connection to the GVB maps websocket open until ctx is done,
+// reconnecting when it drops, subscribed to the stops of the watches. Upcoming buses
+// of interest to a watch are logged and passed on through the returned channel,
+// once for every watch they are kept by. It is closed once the connection is shut down.
+func (c *Client) ConnectAndListen(ctx context.Context) <-chan arrivals.Bus {
+	log := c.Log
+	watches, filtered := c.Watches, c.Filtered
 	msgChan := make(chan WebsocketMessage)
+	busChan := make(chan arrivals.Bus)
+
 	go func() {
+		defer close(msgChan)
+		if c.Replay != nil {
+			c.replay(ctx, msgChan)
+			return
+		}
+
 		for {
-			_, message, err := ws.ReadMessage()
-			if err != nil {
-				log.Fatalf("SHIT HIT THE FAN: %v", err)
+			if err := c.listen(ctx, stops(watches), msgChan); err != nil && ctx.Err() == nil {
+				log.Warn("websocket closed", "err", err)
 			}
 
-			if strings.Contains(string(message), "Ratchet") {
-				log.Println("Subscribing via websocket...")
-				ws.WriteMessage(1, []byte(`[5,"/stops/01346"]`))
-			} else {
-				var msg WebsocketMessage
-				if err := json.Unmarshal(cleanJSON(message), &msg); err != nil {
-					fmt.Printf("Could not unmarshal websocket message into struct: %v", err)
-				}
-				msgChan <- msg
+			select {
+			case <-ctx.Done():
+				log.Info("disconnected from websocket")
+				return
+			case <-c.Clock.After(time.Second * 10):
+				log.Info("reconnecting to websocket")
+				reconnects.Inc()
 			}
 		}
 	}()
 
 	go func() {
-		for {
-			m := <-msgChan
+		defer close(busChan)
+		for m := range msgChan {
+			now := c.Clock.Now()
+			for _, w := range watches {
+				if w.Stop != m.Stop {
+					continue
+				}
+				bus, reason := ofInterest(m, w, now)
+				log := log.With("watch", w.Name, "stop", m.Stop, "line", m.Journey.LineNumber, "journey", m.Trip.Number, "vehicle_type", m.Journey.Vehicletype)
 
-			// Data of interest: line number, final destination (end station)
-			v1 := m.Journey.LineNumber == "35" && m.Journey.Destination == "Olof Palmeplein"
-			v2 := len(m.Calls) > 0 && m.Calls[0].PlannedArrivalAt != ""
-			if v1 == false && v2 == false {
-				continue
-			}
+				if reason != "" && filtered != nil {
+					filtered(reason)
+				}
+				switch reason {
+				case "":
+				case arrivals.FilteredLine, arrivals.FilteredStop:
+					continue
+				case arrivals.FilteredParseError:
+					log.Warn("filtered pass", "reason", reason)
+					continue
+				default:
+					log.Debug("filtered pass", "reason", reason, "arrival", bus.CompiledArrivalTime.Format("15:04:05"), "eta", bus.CompiledArrivalTime.Sub(now))
+					continue
+				}
+				if bus.Approach != nil {
+					log = log.With("stops_away", bus.Approach.Stops)
+				}
+				log.Info("next bus", "arrival", bus.CompiledArrivalTime.Format("15:04:05"), "eta", bus.CompiledArrivalTime.Sub(now))
 
-			// Decide which timestamp to use.
-			// Ideally we would use directly the provided "planned" time,
-			// which includes delays or advances in the schedule.
-			arrivalTime := m.Calls[0].PlannedArrivalAt
-			if m.Calls[0].LiveArrivalAt != "" {
-				arrivalTime = m.Calls[0].LiveArrivalAt
+				select {
+				case busChan <- bus:
+				case <-ctx.Done():
+				}
 			}
+		}
+	}()
 
-			loc, _ := time.LoadLocation("Europe/Amsterdam")
-			busTime, _ := FromClockToTime(arrivalTime)
-			homeTime := time.Now().In(loc)
+	return busChan
+}
 
-			// Filter past events.
-			if busTime.Sub(homeTime) < 0 {
-				h, m, s := busTime.Clock()
-				fmt.Printf("Filtered bus in past: %v:%v:%v (%v)\n", h, m, s, busTime.Sub(homeTime))
-				continue
-			}
+// replay forwards the messages of the replayed frames until they run out or ctx is done.
+func (c *Client) replay(ctx context.Context, msgChan chan<- WebsocketMessage) {
+	for frame := range c.Replay(ctx) {
+		msg, ok := c.decode(frame)
+		if !ok {
+			continue
+		}
 
-			// Filter buses that are too far in the future: 60sec*30=30min
-			if busTime.Sub(homeTime).Seconds() > 60*30 {
-				h, m, s := busTime.Clock()
-				fmt.Printf("Filtered bus too far in the future: %v:%v:%v (%v)\n", h, m, s, busTime.Sub(homeTime))
-				continue
-			}
+		select {
+		case msgChan <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// decode turns a frame into a message. Frames that are not a message are skipped.
+func (c *Client) decode(frame []byte) (WebsocketMessage, bool) {
+	messages.Inc()
+	if c.Record != nil {
+		c.Record(frame)
+	}
+
+	var msg WebsocketMessage
+	if strings.Contains(string(frame), "Ratchet") {
+		return msg, false
+	}
+	stop, b, err := cleanJSON(frame)
+	if err == nil {
+		err = json.Unmarshal(b, &msg)
+	}
+	if err != nil {
+		c.Log.Warn("could not unmarshal websocket message", "err", err)
+		return msg, false
+	}
+	msg.Stop = stop
+	return msg, true
+}
 
-			fmt.Println("-------------------->")
-			//fmt.Printf("%s\n", b)
-			log.Printf("> Next bus 35 arrives in (%s)/(%v)\n", busTime.Sub(homeTime), arrivalTime)
-			fmt.Println("-------------------->")
+// stops returns the stops of the watches, each once.
+func stops(watches []Watch) []string {
+	var codes []string
+	seen := map[string]bool{}
+	for _, w := range watches {
+		if !seen[w.Stop] {
+			seen[w.Stop] = true
+			codes = append(codes, w.Stop)
 		}
+	}
+	return codes
+}
+
+// listen connects to the websocket, subscribes to the passes of the stops and
+// forwards its messages until the connection drops or ctx is done.
+func (c *Client) listen(ctx context.Context, stops []string, msgChan chan<- WebsocketMessage) error {
+	log := c.Log
+	log.Info("connecting to websocket")
+	d := websocket.Dialer{
+		EnableCompression: true,
+		HandshakeTimeout:  time.Minute * 15,
+	}
+
+	ws, _, err := d.DialContext(ctx, "wss://maps-wss.gvb.nl/", http.Header{
+		"User-Agent": []string{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36"},
+	})
+	if err != nil {
+		return fmt.Errorf("could not connect to ws: %v", err)
+	}
+	log.Info("connected to websocket")
+	connected.Set(1)
+	defer connected.Set(0)
+
+	// Unblock ReadMessage when shutting down.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		case <-done:
+		}
+		ws.Close()
 	}()
 
-	return msgChan
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(string(message), "Ratchet") {
+			for _, stop := range stops {
+				log.Debug("subscribing via websocket", "stop", stop)
+				topic, _ := json.Marshal(stopsTopic + stop)
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(`[5,`+string(topic)+`]`)); err != nil {
+					return fmt.Errorf("could not subscribe to stop %v: %v", stop, err)
+				}
+			}
+		}
+		msg, ok := c.decode(message)
+		if !ok {
+			continue
+		}
+
+		select {
+		case msgChan <- msg:
+		case <-ctx.Done():
+			return nil
+		}
+	}
 }
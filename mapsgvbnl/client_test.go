@@ -1,9 +1,15 @@
 package mapsgvbnl
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/clock"
 )
 
 func TestFromClockToTime(t *testing.T) {
@@ -11,20 +17,212 @@ func TestFromClockToTime(t *testing.T) {
 	t2 := "01:39:56"
 	t3 := "23:41:38"
 	t4 := "00:54:39"
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, amsterdam)
 
-	t11, err := FromClockToTime(t1)
+	t11, err := FromClockToTime(t1, now)
 	assert.NoError(t, err)
 	assert.IsTypef(t, time.Now(), *t11, "time.Time")
 
-	t22, err := FromClockToTime(t2)
+	t22, err := FromClockToTime(t2, now)
 	assert.NoError(t, err)
 	assert.IsTypef(t, time.Now(), *t22, "time.Time")
 
-	t33, err := FromClockToTime(t3)
+	t33, err := FromClockToTime(t3, now)
 	assert.NoError(t, err)
 	assert.IsTypef(t, time.Now(), *t33, "time.Time")
 
-	t44, err := FromClockToTime(t4)
+	t44, err := FromClockToTime(t4, now)
 	assert.NoError(t, err)
 	assert.IsTypef(t, time.Now(), *t44, "time.Time")
+
+	_, err = FromClockToTime("10:31", now)
+	assert.Error(t, err)
+	_, err = FromClockToTime("10:xx:58", now)
+	assert.Error(t, err)
+}
+
+func TestCleanJSON(t *testing.T) {
+	stop, msg, err := cleanJSON([]byte(`[8,"/stops/08174","{\"journey\":{\"lineNumber\":\"2\"}}"]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "08174", stop)
+	assert.Equal(t, `{"journey":{"lineNumber":"2"}}`, string(msg))
+
+	for _, frame := range []string{
+		`not json`,
+		`[0,"session",1,"Ratchet/0.4"]`,
+		`[8,"/lines/35","{}"]`,
+		`[8,"/stops/01346",{}]`,
+	} {
+		_, _, err := cleanJSON([]byte(frame))
+		assert.Error(t, err, frame)
+	}
+}
+
+func TestOfInterest(t *testing.T) {
+	at := func(month time.Month, day, h, m int) time.Time {
+		return time.Date(2019, month, day, h, m, 0, 0, amsterdam)
+	}
+	w := Watch{
+		Name: "bus",
+		Stop: "01346",
+		Filter: arrivals.Filter{
+			Lines:        []string{"35"},
+			Destinations: []string{"OLPP"},
+			MaxETA:       time.Minute * 30,
+			WalkTime:     time.Minute * 2,
+		},
+		Destinations: map[string]string{"Olof Palmeplein": "OLPP"},
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		line    string
+		dest    string
+		stop    string // of the call
+		arrival string
+		want    time.Time
+		reason  string
+	}{
+		{"upcoming", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01346", "12:10:00", at(1, 2, 12, 10), ""},
+		{"first call", at(1, 2, 12, 0), "35", "Olof Palmeplein", "", "12:10:00", at(1, 2, 12, 10), ""},
+		{"past", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01346", "11:59:00", at(1, 2, 11, 59), arrivals.FilteredPast},
+		{"too soon", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01346", "12:01:00", at(1, 2, 12, 1), arrivals.FilteredTooSoon},
+		{"too far", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01346", "12:31:00", at(1, 2, 12, 31), arrivals.FilteredTooFar},
+		{"other line", at(1, 2, 12, 0), "15", "Olof Palmeplein", "01346", "12:10:00", at(1, 2, 12, 10), arrivals.FilteredLine},
+		{"other destination", at(1, 2, 12, 0), "35", "Centraal Station", "01346", "12:10:00", at(1, 2, 12, 10), arrivals.FilteredDestination},
+		{"other stop", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01344", "12:10:00", time.Time{}, arrivals.FilteredStop},
+		{"just before midnight", at(1, 2, 23, 55), "35", "Olof Palmeplein", "01346", "00:05:00", at(1, 3, 0, 5), ""},
+		{"just after midnight", at(1, 3, 0, 5), "35", "Olof Palmeplein", "01346", "23:55:00", at(1, 2, 23, 55), arrivals.FilteredPast},
+		{"clocks forward", at(3, 31, 1, 50), "35", "Olof Palmeplein", "01346", "03:05:00", at(3, 31, 3, 5), ""},
+		{"clocks back", time.Date(2019, 10, 27, 1, 50, 0, 0, time.UTC), "35", "Olof Palmeplein", "01346", "03:05:00", at(10, 27, 3, 5), ""},
+		{"unparseable", at(1, 2, 12, 0), "35", "Olof Palmeplein", "01346", "12:10", time.Time{}, arrivals.FilteredParseError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m WebsocketMessage
+			msg := fmt.Sprintf(`{"journey":{"lineNumber":%q,"destination":%q},`+
+				`"calls":[{"stopCode":%q,"plannedArrivalAt":"12:08:00","liveArrivalAt":%q}]}`, tt.line, tt.dest, tt.stop, tt.arrival)
+			assert.NoError(t, json.Unmarshal([]byte(msg), &m))
+			m.Stop = "01346"
+
+			got, reason := ofInterest(m, w, tt.now)
+			assert.Equal(t, tt.reason, reason)
+			assert.True(t, tt.want.Equal(got.CompiledArrivalTime), "got %v, want %v", got.CompiledArrivalTime, tt.want)
+			if reason == "" {
+				assert.Equal(t, "bus", got.Watch)
+				assert.Equal(t, "OLPP", got.FinalDestinationCode)
+				assert.Equal(t, "01346", got.UserStopCode)
+			}
+		})
+	}
+}
+
+func TestOfInterestTransport(t *testing.T) {
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, amsterdam)
+	w := Watch{Name: "tram", Stop: "08174", Filter: arrivals.Filter{TransportTypes: []string{arrivals.TransportTram}, MaxETA: time.Minute * 30}}
+
+	tests := []struct {
+		vehicletype string
+		transport   string
+		reason      string
+	}{
+		{"tram", arrivals.TransportTram, ""},
+		{"TRAM", arrivals.TransportTram, ""},
+		{"bus", arrivals.TransportBus, arrivals.FilteredTransport},
+		{"Metro", arrivals.TransportMetro, arrivals.FilteredTransport},
+		{"veer", arrivals.TransportBoat, arrivals.FilteredTransport},
+		{"", "", ""}, // not known, like the timetable
+	}
+	for _, tt := range tests {
+		var m WebsocketMessage
+		msg := fmt.Sprintf(`{"journey":{"lineNumber":"2","vehicletype":%q},"calls":[{"plannedArrivalAt":"12:10:00"}]}`, tt.vehicletype)
+		assert.NoError(t, json.Unmarshal([]byte(msg), &m))
+
+		bus, reason := ofInterest(m, w, now)
+		assert.Equal(t, tt.reason, reason, tt.vehicletype)
+		assert.Equal(t, tt.transport, bus.TransportType, tt.vehicletype)
+	}
+}
+
+func TestConnectAndListen(t *testing.T) {
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, amsterdam)
+	frame := func(stop, line string) []byte {
+		msg := fmt.Sprintf(`{"journey":{"lineNumber":%q},"calls":[{"stopCode":%q,"plannedArrivalAt":"12:10:00"}]}`, line, stop)
+		b, _ := json.Marshal([]interface{}{8, "/stops/" + stop, msg})
+		return b
+	}
+
+	c := NewClient(nil)
+	c.Clock = clock.NewFake(now)
+	c.Replay = func(ctx context.Context) <-chan []byte {
+		frames := make(chan []byte, 4)
+		frames <- frame("01346", "35")
+		frames <- frame("08174", "2")
+		frames <- frame("08174", "5")
+		frames <- frame("01344", "35") // not subscribed to
+		close(frames)
+		return frames
+	}
+	filter := arrivals.Filter{MaxETA: time.Minute * 30}
+	tram := filter
+	tram.Lines = []string{"2"}
+	c.Watches = []Watch{
+		{Name: "bus", Stop: "01346", Filter: filter},
+		{Name: "tram", Stop: "08174", Filter: tram},
+		{Name: "any", Stop: "08174", Filter: filter},
+	}
+
+	var filtered []string
+	c.Filtered = func(reason string) { filtered = append(filtered, reason) }
+
+	var got []string
+	for bus := range c.ConnectAndListen(context.Background()) {
+		got = append(got, bus.Watch+" "+bus.LineNumber)
+	}
+	assert.Equal(t, []string{"bus 35", "tram 2", "any 2", "any 5"}, got)
+	assert.Equal(t, []string{arrivals.FilteredLine}, filtered, "line 5 by tram")
+	assert.Equal(t, []string{"01346", "08174"}, stops(c.Watches))
+}
+
+func TestStopsAway(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want int
+		ok   bool
+	}{
+		{"approaching", `{"trip":{"lastCallMade":{"callOrder":14}},"calls":[{"stopCode":"01344","callOrder":15},{"stopCode":"01346","callOrder":18}]}`, 4, true},
+		{"at the stop", `{"trip":{"lastCallMade":{"callOrder":18}},"calls":[{"stopCode":"01346","callOrder":18}]}`, 0, true},
+		{"passed", `{"trip":{"lastCallMade":{"callOrder":19}},"calls":[{"stopCode":"01346","callOrder":18}]}`, 0, false},
+		{"no call made", `{"calls":[{"stopCode":"01346","callOrder":18}]}`, 0, false},
+		{"other stop", `{"trip":{"lastCallMade":{"callOrder":14}},"calls":[{"stopCode":"01344","callOrder":15}]}`, 0, false},
+	}
+	for _, tt := range tests {
+		var m WebsocketMessage
+		assert.NoError(t, json.Unmarshal([]byte(tt.msg), &m))
+		n, ok := StopsAway(m, "01346")
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.want, n, tt.name)
+	}
+
+	// The stop of a watch, by its user stop or timing point code.
+	var m WebsocketMessage
+	assert.NoError(t, json.Unmarshal([]byte(`{"trip":{"lastCallMade":{"callOrder":14}},"calls":[{"stopCode":"30001346","callOrder":17}]}`), &m))
+	n, ok := StopsAway(m, "01346", "30001346")
+	assert.True(t, ok)
+	assert.Equal(t, 3, n)
+	_, ok = StopsAway(m, "08174")
+	assert.False(t, ok)
+
+	w := Watch{Name: "bus", Stop: "01346", Filter: arrivals.Filter{MaxETA: time.Minute * 30}}
+	assert.NoError(t, json.Unmarshal([]byte(`{"trip":{"lastCallMade":{"callOrder":14}},`+
+		`"calls":[{"stopCode":"01344","callOrder":15,"plannedArrivalAt":"12:05:00"},{"stopCode":"01346","callOrder":18,"plannedArrivalAt":"12:10:00"}]}`), &m))
+	bus, reason := ofInterest(m, w, time.Date(2019, 1, 2, 12, 0, 0, 0, amsterdam))
+	assert.Equal(t, "", reason)
+	if assert.NotNil(t, bus.Approach) {
+		assert.Equal(t, 4, bus.Approach.Stops)
+	}
+	assert.Equal(t, 18, bus.StopOrder)
+	assert.True(t, time.Date(2019, 1, 2, 12, 10, 0, 0, amsterdam).Equal(bus.CompiledArrivalTime), "at the stop watched, not the first call")
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/metrics"
+)
+
+var (
+	passesReceived = metrics.NewCounter("passes_received_total",
+		"Passes received from OVAPI.")
+	passesFiltered = metrics.NewCounter("passes_filtered_total",
+		"Passes dropped before reaching the display, by reason.", "reason")
+	etaSeconds = metrics.NewGauge("bus_eta_seconds",
+		"Seconds until the next bus arrives, by line.", "line")
+	delaySeconds = metrics.NewHistogram("bus_delay_seconds",
+		"Expected minus planned arrival of every pass on each fetch.",
+		[]float64{-120, -60, 0, 60, 120, 300, 600, 900})
+	framesPushed = metrics.NewCounter("display_frames_total",
+		"Frames pushed to the display.")
+)
+
+// observeBuses updates the ETA and delay metrics after a fetch.
+func observeBuses(buses []arrivals.Bus, now time.Time) {
+	next := map[string]time.Duration{}
+	for _, bus := range buses {
+		delaySeconds.Observe(float64(bus.DelaySeconds))
+
+		eta := bus.CompiledArrivalTime.Sub(now)
+		if cur, ok := next[bus.LineNumber]; !ok || eta < cur {
+			next[bus.LineNumber] = eta
+		}
+	}
+
+	etaSeconds.Reset()
+	for line, eta := range next {
+		etaSeconds.Set(eta.Seconds(), line)
+	}
+}
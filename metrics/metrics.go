@@ -0,0 +1,245 @@
+// Package metrics is a minimal Prometheus instrumentation library:
+// counters, gauges and histograms with labels, served in the text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit latencies in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics to be exposed.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// Default is the registry used by the New functions and Handler.
+var Default = &Registry{}
+
+// Counter only goes up.
+type Counter struct{ m *metric }
+
+// Gauge goes up and down.
+type Gauge struct{ m *metric }
+
+// Histogram counts observations in buckets.
+type Histogram struct{ m *metric }
+
+// NewCounter registers a counter on the Default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{Default.register(name, help, "counter", nil, labels)}
+}
+
+// NewGauge registers a gauge on the Default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{Default.register(name, help, "gauge", nil, labels)}
+}
+
+// NewHistogram registers a histogram on the Default registry.
+// DefaultBuckets are used when buckets is nil.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{Default.register(name, help, "histogram", buckets, labels)}
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.m.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Set sets the gauge with the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.m.update(labelValues, func(s *series) { s.value++ })
+}
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.m.update(labelValues, func(s *series) { s.value-- })
+}
+
+// Reset removes all label combinations, e.g. lines that no longer run.
+func (g *Gauge) Reset() {
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+
+	g.m.series = map[string]*series{}
+}
+
+// Observe adds v to the histogram with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.update(labelValues, func(s *series) {
+		for i, b := range h.m.buckets {
+			if v <= b {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += v
+	})
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.WriteTo(w)
+	})
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+
+	return m
+}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64 // the value, or the sum for histograms
+	count       uint64
+	counts      []uint64
+}
+
+func (m *metric) update(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %v wants %d label values, passed: %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(m.buckets)),
+		}
+		m.series[key] = s
+	}
+	fn(s)
+}
+
+func (m *metric) write(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", m.name, escape(m.help, false))
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := m.series[k]
+		if m.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, m.labelPairs(s, ""), format(s.value))
+			continue
+		}
+
+		for i, le := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelPairs(s, format(le)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelPairs(s, "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, m.labelPairs(s, ""), format(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, m.labelPairs(s, ""), s.count)
+	}
+}
+
+// labelPairs formats the labels of s, adding `le` for histogram buckets.
+func (m *metric) labelPairs(s *series, le string) string {
+	var pairs []string
+	for i, l := range m.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escape(s.labelValues[i], true)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(s string, quotes bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := &Registry{}
+	c := &Counter{r.register("requests_total", "Requests by code.", "counter", nil, []string{"code"})}
+	g := &Gauge{r.register("connected", "Connected.", "gauge", nil, nil)}
+	h := &Histogram{r.register("latency_seconds", "Latency.", "histogram", []float64{0.1, 1}, nil)}
+
+	c.Inc("200")
+	c.Inc("200")
+	c.Inc(`5"0"0`)
+	g.Set(1)
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP requests_total Requests by code.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="5\"0\"0"} 1
+# HELP connected Connected.
+# TYPE connected gauge
+connected 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+`, b.String())
+}
+
+func TestGaugeReset(t *testing.T) {
+	r := &Registry{}
+	g := &Gauge{r.register("eta_seconds", "ETA.", "gauge", nil, []string{"line"})}
+
+	g.Set(60, "35")
+	g.Reset()
+	g.Set(120, "22")
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	assert.NotContains(t, b.String(), `line="35"`)
+	assert.Contains(t, b.String(), `eta_seconds{line="22"} 120`)
+}
@@ -1,31 +1,97 @@
 package ovapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/metrics"
+)
+
+var (
+	requests = metrics.NewCounter("ovapi_requests_total",
+		"Requests to OVAPI by HTTP status code, `error` when no response came back.", "code")
+	latency = metrics.NewHistogram("ovapi_request_duration_seconds",
+		"Time taken by requests to OVAPI.", nil)
 )
 
-type OVAPIResponse struct {
-	Station struct {
-		DirectionOlofPalmeplein struct {
-			Stop struct {
-				Longitude                       float64 `json:"Longitude"`
-				Latitude                        float64 `json:"Latitude"`
-				TimingPointTown                 string  `json:"TimingPointTown"`
-				TimingPointName                 string  `json:"TimingPointName"`
-				TimingPointCode                 string  `json:"TimingPointCode"`
-				StopAreaCode                    string  `json:"StopAreaCode"`
-				TimingPointWheelChairAccessible string  `json:"TimingPointWheelChairAccessible"`
-				TimingPointVisualAccessible     string  `json:"TimingPointVisualAccessible"`
-			} `json:"Stop"`
-			Passes map[string]bus `json:"Passes"`
-		} `json:"30001346"`
-	} `json:"01346"`
+// Departures are the timing points of a stop area, by TimingPointCode.
+// A stop area is usually a stop with a timing point for each direction.
+type Departures map[string]TimingPoint
+
+// TimingPoint is a stop, the buses passing it and the messages of the operator about it.
+type TimingPoint struct {
+	Stop     Stop               `json:"Stop"`
+	Passes   map[string]Pass    `json:"Passes"`
+	Messages map[string]Message `json:"GeneralMessages"`
+}
+
+// Stop is where a timing point is.
+type Stop struct {
+	Longitude                       float64 `json:"Longitude"`
+	Latitude                        float64 `json:"Latitude"`
+	TimingPointTown                 string  `json:"TimingPointTown"`
+	TimingPointName                 string  `json:"TimingPointName"`
+	TimingPointCode                 string  `json:"TimingPointCode"`
+	StopAreaCode                    string  `json:"StopAreaCode"`
+	TimingPointWheelChairAccessible string  `json:"TimingPointWheelChairAccessible"`
+	TimingPointVisualAccessible     string  `json:"TimingPointVisualAccessible"`
+}
+
+// Passes returns the passes at all timing points.
+func (d Departures) Passes() []Pass {
+	var out []Pass
+	for _, tp := range d {
+		for id, pass := range tp.Passes {
+			pass.ID = id
+			out = append(out, pass)
+		}
+	}
+	return out
+}
+
+// Messages returns the messages at all timing points, ordered by ID.
+func (d Departures) Messages() []Message {
+	var out []Message
+	for _, tp := range d {
+		for id, m := range tp.Messages {
+			m.ID = id
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Stop returns the timing point with the lowest code, which has a location for most stop areas.
+func (d Departures) Stop() (Stop, bool) {
+	var (
+		first Stop
+		ok    bool
+	)
+	for code, tp := range d {
+		if !ok || code < first.TimingPointCode {
+			first, ok = tp.Stop, true
+			first.TimingPointCode = code
+		}
+	}
+	return first, ok
 }
 
-type bus struct {
+// Pass is a bus passing the stop.
+type Pass struct {
+	ID string `json:"-"` // its key in Passes, the journey, e.g. GVB_20181117_35_1101_0
+
 	// Grouped data of interest
 	TargetArrivalTime   string `json:"TargetArrivalTime"`   // convert to time: 2018-11-17T17:22:16; – planned arrival time
 	TargetDepartureTime string `json:"TargetDepartureTime"` // same ^
@@ -67,29 +133,163 @@ type bus struct {
 	TimingPointVisualAccessible     string `json:"TimingPointVisualAccessible"`
 }
 
-func RequestDataFromOV() (*OVAPIResponse, error) {
-	req, err := http.NewRequest("GET", "https://v0.ovapi.nl/stopareacode/01346/departures", nil)
+// Message is free text of the operator about a timing point, e.g. a diversion:
+// a KV15 general message.
+type Message struct {
+	ID string `json:"-"` // its key in GeneralMessages
+
+	DataOwnerCode       string `json:"DataOwnerCode"`       // GVB
+	TimingPointCode     string `json:"TimingPointCode"`     // 30001346
+	MessageType         string `json:"MessageType"`         // GENERAL, ADDITIONAL, MISC, OVERRULE
+	MessageDurationType string `json:"MessageDurationType"` // REMOVE, FIRSTVEJO, ENDTIME
+	MessagePriority     string `json:"MessagePriority"`     // CALAMITY, PTPROCESS, COMMERCIAL, MISC
+	MessageStartTime    string `json:"MessageStartTime"`    // 2018-11-17T06:00:00
+	MessageEndTime      string `json:"MessageEndTime"`      // empty until removed
+	MessageContent      string `json:"MessageContent"`      // Door werkzaamheden rijdt lijn 35 niet via ...
+
+	// LinePlanningNumbers are the lines the message is about, all when empty.
+	LinePlanningNumbers []string `json:"LinePlanningNumbers"`
+}
+
+// Client fetches departures from OVAPI.
+type Client struct {
+	Log        *logger.Logger
+	URL        string // DefaultURL, or a test server; %s is the stop area code
+	IndexURL   string // DefaultIndexURL, or a test server
+	JourneyURL string // DefaultJourneyURL, or a test server; %s is the journey
+
+	// HTTP does the requests. Its Transport can capture or replay responses.
+	HTTP *http.Client
+
+	// Every is the least time between the start of two requests,
+	// so fetching many stop areas at once does not hammer OVAPI.
+	Every time.Duration
+	Clock clock.Clock
+
+	mu   sync.Mutex
+	next time.Time // when the next request may start
+}
+
+// DefaultURL has the departures from a stop area.
+const DefaultURL = "https://v0.ovapi.nl/stopareacode/%s/departures"
+
+// DefaultIndexURL lists all stop areas.
+const DefaultIndexURL = "https://v0.ovapi.nl/stopareacode/"
+
+// DefaultJourneyURL has the stops of a journey.
+const DefaultJourneyURL = "https://v0.ovapi.nl/journey/%s"
+
+// NewClient returns an OVAPI Client logging to log, which may be nil.
+func NewClient(log *logger.Logger) *Client {
+	return &Client{
+		Log:        log.With("source", "ovapi"),
+		URL:        DefaultURL,
+		IndexURL:   DefaultIndexURL,
+		JourneyURL: DefaultJourneyURL,
+		HTTP:       &http.Client{},
+		Clock:      clock.Real,
+	}
+}
+
+// Departures fetches the departures from the stop area with stopAreaCode, e.g. 01346.
+func (c *Client) Departures(ctx context.Context, stopAreaCode string) (Departures, error) {
+	b, err := c.get(ctx, fmt.Sprintf(c.URL, stopAreaCode))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36")
 
-	client := http.Client{}
-	resp, err := client.Do(req)
+	var areas map[string]Departures
+	if err := json.Unmarshal(b, &areas); err != nil {
+		return nil, fmt.Errorf("could not unmarshal json: %v", err)
+	}
+	d, ok := areas[stopAreaCode]
+	if !ok {
+		return nil, fmt.Errorf("response has no departures from stop area %v", stopAreaCode)
+	}
+	c.Log.Debug("received passes", "stop_area", stopAreaCode, "passes", len(d.Passes()))
+
+	return d, nil
+}
+
+// Journey fetches the stops of the journey with id, the key of its pass,
+// in the order the bus calls at them. Stops it passed have TripStopStatus PASSED.
+func (c *Client) Journey(ctx context.Context, id string) ([]Pass, error) {
+	b, err := c.get(ctx, fmt.Sprintf(c.JourneyURL, id))
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
+	var journeys map[string]struct {
+		Stops map[string]Pass `json:"Stops"`
+	}
+	if err := json.Unmarshal(b, &journeys); err != nil {
+		return nil, fmt.Errorf("could not unmarshal json: %v", err)
+	}
+	j, ok := journeys[id]
+	if !ok {
+		return nil, fmt.Errorf("response has no journey %v", id)
+	}
+
+	stops := make([]Pass, 0, len(j.Stops))
+	for _, stop := range j.Stops {
+		stop.ID = id
+		stops = append(stops, stop)
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].UserStopOrderNumber < stops[j].UserStopOrderNumber
+	})
+	return stops, nil
+}
+
+// get requests url once the rate limit allows and returns the body of a 200 response.
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36")
 
-	var ov OVAPIResponse
-	if err := json.Unmarshal(b, &ov); err != nil {
-		fmt.Printf("could not unmarshal json: %v", err)
+	start := time.Now()
+	resp, err := c.HTTP.Do(req)
+	took := time.Since(start)
+	latency.Observe(took.Seconds())
+	if err != nil {
+		requests.Inc("error")
+		return nil, err
 	}
+	requests.Inc(strconv.Itoa(resp.StatusCode))
+	c.Log.Debug("requested", "url", url, "status", resp.StatusCode, "took", took)
 
-	return &ov, nil
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from OVAPI: %v", resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// wait blocks until the next request may start, or ctx is done.
+func (c *Client) wait(ctx context.Context) error {
+	c.mu.Lock()
+	now := c.Clock.Now()
+	at := c.next
+	if at.Before(now) {
+		at = now
+	}
+	c.next = at.Add(c.Every)
+	c.mu.Unlock()
+
+	if at.Equal(now) {
+		return nil
+	}
+	select {
+	case <-c.Clock.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,101 @@
+package ovapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDataFromOV(t *testing.T) {
+	otherStop, err := ioutil.ReadFile("testdata/other_stop.json")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		passes int
+		err    bool
+	}{
+		{"departures", http.StatusOK, `{"01346":{"30001346":{"Stop":{"TimingPointCode":"30001346"},` +
+			`"Passes":{"a":{"LinePublicNumber":"35","JourneyNumber":1101},"b":{"LinePublicNumber":"15"}}}}}`, 2, false},
+		{"no passes", http.StatusOK, `{"01346":{"30001346":{"Stop":{"TimingPointCode":"30001346"},"Passes":{}}}}`, 0, false},
+		{"other stop", http.StatusOK, string(otherStop), 0, true},
+		{"server error", http.StatusInternalServerError, `{}`, 0, true},
+		{"not json", http.StatusOK, `<html>`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewClient(nil)
+			c.URL = srv.URL + "/stopareacode/%s/departures"
+			d, err := c.Departures(context.Background(), "01346")
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Len(t, d.Passes(), tt.passes)
+			}
+		})
+	}
+}
+
+func TestDeparturesRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"01346":{"30001346":{"Passes":{}}},"01347":{"30001347":{"Passes":{}}}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(nil)
+	c.URL = srv.URL + "/stopareacode/%s/departures"
+	c.Every = time.Millisecond * 50
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, code := range []string{"01346", "01347", "01346"} {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			_, err := c.Departures(context.Background(), code)
+			assert.NoError(t, err)
+		}(code)
+	}
+	wg.Wait()
+
+	assert.True(t, time.Since(start) >= c.Every*2, "three requests took %v", time.Since(start))
+}
+
+func TestJourney(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"GVB_20181117_35_1101_0":{"Stops":{` +
+			`"10":{"UserStopOrderNumber":10,"TripStopStatus":"DRIVING"},` +
+			`"2":{"UserStopOrderNumber":2,"TripStopStatus":"PASSED"},` +
+			`"9":{"UserStopOrderNumber":9,"TripStopStatus":"ARRIVED"}}}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(nil)
+	c.JourneyURL = srv.URL + "/journey/%s"
+	stops, err := c.Journey(context.Background(), "GVB_20181117_35_1101_0")
+	if assert.NoError(t, err) && assert.Len(t, stops, 3) {
+		assert.Equal(t, 2, stops[0].UserStopOrderNumber)
+		assert.Equal(t, 9, stops[1].UserStopOrderNumber)
+		assert.Equal(t, 10, stops[2].UserStopOrderNumber)
+		assert.Equal(t, "GVB_20181117_35_1101_0", stops[0].ID)
+	}
+
+	_, err = c.Journey(context.Background(), "GVB_20181117_35_1102_0")
+	assert.Error(t, err, "answered with another journey")
+}
@@ -0,0 +1,108 @@
+package ovapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// StopArea is a stop as listed on /stopareacode/, usually with a timing point for each direction.
+type StopArea struct {
+	StopAreaCode    string  `json:"StopAreaCode"`
+	TimingPointName string  `json:"TimingPointName"`
+	TimingPointTown string  `json:"TimingPointTown"`
+	Latitude        float64 `json:"Latitude"`
+	Longitude       float64 `json:"Longitude"`
+}
+
+// StopAreas fetches all stop areas, ordered by code.
+func (c *Client) StopAreas(ctx context.Context) ([]StopArea, error) {
+	b, err := c.get(ctx, c.IndexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var index map[string]StopArea
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("could not unmarshal json: %v", err)
+	}
+
+	areas := make([]StopArea, 0, len(index))
+	for code, a := range index {
+		if a.StopAreaCode == "" {
+			a.StopAreaCode = code
+		}
+		areas = append(areas, a)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].StopAreaCode < areas[j].StopAreaCode
+	})
+	c.Log.Debug("received stop areas", "stop_areas", len(areas))
+
+	return areas, nil
+}
+
+// Search returns the stop areas with every word of query in their name or town,
+// ignoring case, ordered by town and name.
+func Search(areas []StopArea, query string) []StopArea {
+	words := strings.Fields(strings.ToLower(query))
+
+	var out []StopArea
+	for _, a := range areas {
+		text := strings.ToLower(a.TimingPointName + " " + a.TimingPointTown)
+		match := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, a)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].TimingPointTown != out[j].TimingPointTown {
+			return out[i].TimingPointTown < out[j].TimingPointTown
+		}
+		return out[i].TimingPointName < out[j].TimingPointName
+	})
+	return out
+}
+
+// Nearest returns the stop areas ordered by their distance to lat, lon.
+// Stop areas without a location are left out.
+func Nearest(areas []StopArea, lat, lon float64) []StopArea {
+	var out []StopArea
+	for _, a := range areas {
+		if a.Latitude != 0 || a.Longitude != 0 {
+			out = append(out, a)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Distance(lat, lon) < out[j].Distance(lat, lon)
+	})
+	return out
+}
+
+// Distance returns how many meters the stop area is from lat, lon.
+func (a StopArea) Distance(lat, lon float64) float64 {
+	return Distance(a.Latitude, a.Longitude, lat, lon)
+}
+
+// Distance returns how many meters lat1, lon1 is from lat2, lon2 as the crow flies.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000 // meters
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
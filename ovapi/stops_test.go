@@ -0,0 +1,42 @@
+package ovapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopAreas(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/stopareas.json")
+	}))
+	defer srv.Close()
+
+	c := NewClient(nil)
+	c.IndexURL = srv.URL + "/stopareacode/"
+	areas, err := c.StopAreas(context.Background())
+	assert.NoError(t, err)
+	if !assert.Len(t, areas, 5) {
+		return
+	}
+	assert.Equal(t, "57330", areas[3].StopAreaCode)
+
+	codes := func(areas []StopArea) []string {
+		var out []string
+		for _, a := range areas {
+			out = append(out, a.StopAreaCode)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"57330", "01346"}, codes(Search(areas, "olof palme")))
+	assert.Equal(t, []string{"01346"}, codes(Search(areas, "Palme amsterdam")))
+	assert.Empty(t, Search(areas, "centraal"))
+
+	// Near the Burgemeester Fockstraat.
+	near := Nearest(areas, 52.3807, 4.8290)
+	assert.Equal(t, []string{"08174", "01346", "01347", "57330"}, codes(near))
+	assert.InDelta(t, 28, near[0].Distance(52.3807, 4.8290), 5)
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/brightness"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/gtfs"
+	"gitlab.org/go-unicord-phat-lucian/history"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+// poller fetches the upcoming buses from OVAPI,
+// falling back on the timetable when that fails.
+type poller struct {
+	cfg   config.Config
+	clock clock.Clock
+	oc    *ovapi.Client
+	tt    *gtfs.Timetable        // nil without a schedule
+	rec   *history.Recorder      // nil when no history is kept
+	bc    *brightness.Controller // nil when not shown
+	sch   *scheduler             // gets the alerts, nil when not shown
+	sl    *sleeper
+	st    *status
+	live  *live // buses heard on the websocket, nil without
+	out   chan<- []arrivals.Bus
+
+	// reload receives configs to switch to, fetching straight away.
+	reload <-chan config.Config
+
+	// The correction of the ETAs, relearned every relearnInterval.
+	model   *history.Model
+	learned time.Time
+}
+
+// relearnInterval is how often the correction is learned again from the history.
+const relearnInterval = time.Hour * 6
+
+// run fetches the upcoming buses every poll_interval, or straight away
+// when the display wakes up, and sends them to out until ctx is done.
+// In between the buses heard on the websocket are sent along with them as they come in.
+func (p *poller) run(ctx context.Context) {
+	var polled []arrivals.Bus
+	for {
+		buses, updated, err := p.pull(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		now := p.clock.Now()
+		if err == nil && p.tt != nil && !updated.IsZero() && now.Sub(updated) > p.cfg.Schedule.StaleAfter.Duration {
+			err = fmt.Errorf("realtime data is stale, last updated at %v", updated.Format("15:04:05"))
+		}
+		p.st.fetched("ovapi", err, now)
+
+		if err != nil {
+			p.oc.Log.Warn("could not fetch departures", "err", err)
+		}
+		if err != nil && p.tt != nil {
+			buses, err = p.scheduled(now), nil
+			p.st.fellBack("gtfs")
+		}
+
+		if err == nil {
+			polled = buses
+			observeBuses(buses, now)
+			if !p.send(ctx, buses, now) {
+				return
+			}
+		}
+
+		next := p.clock.After(p.cfg.PollInterval.Duration)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-next:
+				break wait
+			case <-p.sl.woken:
+				break wait
+			case cfg := <-p.reload:
+				p.apply(cfg)
+				break wait
+			case <-p.live.updates():
+				if !p.send(ctx, polled, p.clock.Now()) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// send passes buses on with the ones heard on the websocket, recording them
+// as shown. It returns false when ctx is done first.
+func (p *poller) send(ctx context.Context, buses []arrivals.Bus, now time.Time) bool {
+	buses = p.live.merge(buses, p.cfg, now)
+	p.st.shown(buses)
+
+	select {
+	case p.out <- buses:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// apply switches to cfg, opening the history and timetable when their files
+// changed. When the new ones can not be opened the old ones are kept.
+func (p *poller) apply(cfg config.Config) {
+	log := p.oc.Log
+
+	if cfg.History != p.cfg.History {
+		var (
+			rec *history.Recorder
+			err error
+		)
+		if cfg.History != "" {
+			rec, err = history.Open(cfg.History)
+		}
+		if err != nil {
+			log.Warn("could not open history, keeping the old one", "history", cfg.History, "err", err)
+			cfg.History = p.cfg.History
+		} else {
+			if p.rec != nil {
+				p.rec.Close()
+			}
+			p.rec = rec
+		}
+	}
+	if cfg.History != p.cfg.History || cfg.Correct != p.cfg.Correct {
+		p.learned = time.Time{}
+	}
+
+	if cfg.Schedule.GTFS != p.cfg.Schedule.GTFS || cfg.Schedule.StopCode != p.cfg.Schedule.StopCode {
+		var (
+			tt  *gtfs.Timetable
+			err error
+		)
+		if cfg.Schedule.GTFS != "" {
+			log.Info("loading timetable", "gtfs", cfg.Schedule.GTFS, "stop", cfg.Schedule.StopCode)
+			tt, err = gtfs.Load(cfg.Schedule.GTFS, cfg.Schedule.StopCode)
+		}
+		if err != nil {
+			log.Warn("could not load timetable, keeping the old one", "err", err)
+			cfg.Schedule.GTFS, cfg.Schedule.StopCode = p.cfg.Schedule.GTFS, p.cfg.Schedule.StopCode
+		} else {
+			p.tt = tt
+		}
+	}
+
+	p.oc.Every = cfg.RequestInterval.Duration
+	p.cfg = cfg
+	log.Info("applied config", "watches", len(cfg.Watchlist()))
+}
+
+// pull returns the upcoming buses of all watches, ordered by when to leave for them,
+// and when the newest realtime update was made. It fails when no stop area could be fetched.
+func (p *poller) pull(ctx context.Context) ([]arrivals.Bus, time.Time, error) {
+	watches := p.cfg.Watchlist()
+	deps, err := p.fetch(ctx, stopAreas(watches))
+	if len(deps) == 0 {
+		p.alert(nil)
+		return nil, time.Time{}, err
+	}
+	if err != nil {
+		p.oc.Log.Warn("could not fetch all departures", "err", err)
+	}
+
+	if stop, ok := deps[watches[0].StopAreaCode].Stop(); ok && p.bc != nil && (stop.Latitude != 0 || stop.Longitude != 0) {
+		p.bc.SetLocation(stop.Latitude, stop.Longitude)
+	}
+
+	// Passes of a stop area that could not be fetched would be recorded as gone.
+	if p.rec != nil && err == nil {
+		if err := p.rec.Record(p.clock.Now(), historyPasses(deps)); err != nil {
+			p.oc.Log.Warn("could not record history", "err", err)
+		}
+	}
+
+	now := p.clock.Now()
+	var (
+		buses  []arrivals.Bus
+		alerts []arrivals.Alert
+		seen   = map[string]bool{}
+	)
+	for _, w := range watches {
+		d, ok := deps[w.StopAreaCode]
+		if !ok {
+			continue
+		}
+		buses = append(buses, fromOVAPI(d, w, p.cfg, now, p.oc.Log.With("watch", w.Name, "stop_area", w.StopAreaCode))...)
+
+		for _, a := range arrivals.AlertsFromOVAPI(d, filterOf(w, p.cfg), now) {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	p.alert(alerts)
+	if p.cfg.Correct {
+		p.correct(buses, now)
+	}
+	sort.SliceStable(buses, func(i, j int) bool {
+		return buses[i].Leave().Before(buses[j].Leave())
+	})
+	if p.cfg.StopsAway && len(buses) > 0 {
+		p.approach(ctx, &buses[0])
+	}
+
+	for _, bus := range buses {
+		p.oc.Log.Info("upcoming bus",
+			"watch", bus.Watch,
+			"line", bus.LineNumber,
+			"status", bus.TripStatus,
+			"arrival", bus.CompiledArrivalTime,
+			"eta", bus.CompiledArrivalTime.Sub(now),
+			"delay", time.Duration(bus.DelaySeconds)*time.Second,
+		)
+	}
+
+	return buses, lastUpdated(deps), nil
+}
+
+// approach sets how far bus still has to go from its journey.
+func (p *poller) approach(ctx context.Context, bus *arrivals.Bus) {
+	if bus.Journey == "" || bus.StopOrder == 0 {
+		return
+	}
+	journey, err := p.oc.Journey(ctx, bus.Journey)
+	if err != nil {
+		p.oc.Log.Warn("could not fetch journey", "journey", bus.Journey, "err", err)
+		return
+	}
+
+	a, ok := arrivals.ApproachOf(journey, bus.StopOrder)
+	if !ok {
+		p.oc.Log.Debug("next bus has not left yet", "journey", bus.Journey)
+		return
+	}
+	bus.Approach = &a
+	p.oc.Log.Info("next bus approaching", "journey", bus.Journey, "stops", a.Stops, "meters", int(a.Meters))
+}
+
+// alert passes the alerts on to the display, unless they are hidden.
+func (p *poller) alert(alerts []arrivals.Alert) {
+	if p.sch == nil {
+		return
+	}
+	if p.cfg.Alerts.Hide {
+		alerts = nil
+	}
+	for _, a := range alerts {
+		p.oc.Log.Info("alert", "id", a.ID, "stop", a.Stop, "lines", strings.Join(a.Lines, ","), "text", a.Text)
+	}
+	p.sch.SetAlerts(alerts)
+}
+
+// fetch requests the departures from all stop areas at once, as fast as
+// request_interval allows. The error tells which ones could not be fetched.
+func (p *poller) fetch(ctx context.Context, codes []string) (map[string]ovapi.Departures, error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		deps = map[string]ovapi.Departures{}
+		errs = make([]error, len(codes))
+	)
+	for i, code := range codes {
+		wg.Add(1)
+		go func(i int, code string) {
+			defer wg.Done()
+			d, err := p.oc.Departures(ctx, code)
+			if err != nil {
+				errs[i] = fmt.Errorf("stop area %v: %v", code, err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			deps[code] = d
+		}(i, code)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return deps, errors.New(strings.Join(failed, "; "))
+	}
+	return deps, nil
+}
+
+// stopAreas returns the stop areas of the watches, each once.
+func stopAreas(watches []config.Watch) []string {
+	var codes []string
+	seen := map[string]bool{}
+	for _, w := range watches {
+		if !seen[w.StopAreaCode] {
+			seen[w.StopAreaCode] = true
+			codes = append(codes, w.StopAreaCode)
+		}
+	}
+	return codes
+}
+
+// scheduled returns the buses planned in the timetable, which is of the stop
+// of the one watch: config.Validate does not allow it with more.
+func (p *poller) scheduled(now time.Time) []arrivals.Bus {
+	w := p.cfg.Watchlist()[0]
+	log := p.oc.Log.With("source", "gtfs", "watch", w.Name)
+
+	var buses []arrivals.Bus
+	for _, a := range p.tt.Arrivals(now, now.Add(p.cfg.MaxETA.Duration)) {
+		bus := arrivals.Bus{
+			LineNumber:           a.Line,
+			TransportType:        arrivals.TransportOfRouteType(a.Type),
+			TripStatus:           "SCHEDULED",
+			FinalDestinationName: a.Headsign,
+			FinalDestinationCode: p.cfg.Schedule.Destinations[a.Headsign],
+			CompiledArrivalTime:  a.Time,
+			PlannedArrivalTime:   a.Time,
+			Scheduled:            true,
+			Watch:                w.Name,
+			WalkTime:             w.WalkTime.Duration,
+		}
+		if keep(bus, w, p.cfg, now, log.With("line", a.Line, "trip", a.TripID)) {
+			buses = append(buses, bus)
+		}
+	}
+	log.Info("showing the schedule", "buses", len(buses))
+
+	return buses
+}
+
+// lastUpdated returns the newest LastUpdateTimeStamp of all passes.
+func lastUpdated(deps map[string]ovapi.Departures) time.Time {
+	var newest time.Time
+	for _, d := range deps {
+		for _, pass := range d.Passes() {
+			if t, err := arrivals.ParseUpdateTime(pass.LastUpdateTimeStamp); err == nil && t.After(newest) {
+				newest = t
+			}
+		}
+	}
+	return newest
+}
+
+// correct adjusts the ETAs of buses predicted at now by the learned bias.
+func (p *poller) correct(buses []arrivals.Bus, now time.Time) {
+	if now.Sub(p.learned) > relearnInterval {
+		records, err := history.Load(p.cfg.History)
+		if err != nil {
+			p.oc.Log.Warn("could not learn correction", "err", err)
+			return
+		}
+		p.model = history.Learn(records, time.Local)
+		p.learned = now
+		p.oc.Log.Info("learned correction", "records", len(records))
+	}
+
+	for i, bus := range buses {
+		t, ok := p.model.Correct(bus.LineNumber, bus.CompiledArrivalTime, now)
+		if !ok {
+			continue
+		}
+		p.oc.Log.Debug("corrected ETA", "line", bus.LineNumber, "expected", bus.CompiledArrivalTime, "corrected", t)
+
+		buses[i].CompiledArrivalTime = t
+		buses[i].DelaySeconds = int(t.Sub(bus.PlannedArrivalTime).Seconds())
+		buses[i].Corrected = true
+	}
+}
+
+// historyPasses returns all passes at the stop areas, of every line,
+// skipping the ones without valid arrival times. The stop is always recorded,
+// so the keys stay the same when stop areas are added or removed.
+func historyPasses(deps map[string]ovapi.Departures) []history.Pass {
+	var passes []history.Pass
+	for _, d := range deps {
+		for _, pass := range d.Passes() {
+			target, err := arrivals.ParsePassTime(pass.TargetArrivalTime)
+			if err != nil {
+				continue
+			}
+			expected, err := arrivals.ParsePassTime(pass.ExpectedArrivalTime)
+			if err != nil {
+				continue
+			}
+
+			passes = append(passes, history.Pass{
+				OperationDate: pass.OperationDate,
+				JourneyNumber: pass.JourneyNumber,
+				Line:          pass.LinePublicNumber,
+				Destination:   pass.DestinationCode,
+				Stop:          pass.TimingPointCode,
+				Status:        pass.TripStopStatus,
+				Target:        target,
+				Expected:      expected,
+			})
+		}
+	}
+
+	return passes
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+func TestHistoryPasses(t *testing.T) {
+	pass := func(journey int, stop string) ovapi.Pass {
+		return ovapi.Pass{
+			OperationDate:       "2019-01-02",
+			JourneyNumber:       journey,
+			LinePublicNumber:    "35",
+			TimingPointCode:     stop,
+			TargetArrivalTime:   "2019-01-02T12:10:00",
+			ExpectedArrivalTime: "2019-01-02T12:11:00",
+		}
+	}
+	one := ovapi.Departures{"30001346": {Passes: map[string]ovapi.Pass{
+		"a": pass(1101, "30001346"),
+		"b": {JourneyNumber: 1102, TargetArrivalTime: "soon"},
+	}}}
+	two := ovapi.Departures{"30008174": {Passes: map[string]ovapi.Pass{"c": pass(2201, "30008174")}}}
+
+	// The keys of a stop area do not change when another one is added.
+	passes := historyPasses(map[string]ovapi.Departures{"01346": one})
+	if assert.Len(t, passes, 1) {
+		assert.Equal(t, "2019-01-02/35/1101/30001346", passes[0].Key())
+	}
+	keys := map[string]bool{}
+	for _, p := range historyPasses(map[string]ovapi.Departures{"01346": one, "08174": two}) {
+		keys[p.Key()] = true
+	}
+	assert.Equal(t, map[string]bool{"2019-01-02/35/1101/30001346": true, "2019-01-02/35/2201/30008174": true}, keys)
+}
+
+func TestPollerSend(t *testing.T) {
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default()
+	out := make(chan []arrivals.Bus, 1)
+	p := &poller{cfg: cfg, st: &status{}, live: newLive(), out: out}
+
+	polled := arrivals.Bus{Watch: "default", LineNumber: "35", FinalDestinationCode: "OLPP", CompiledArrivalTime: now.Add(time.Minute * 9)}
+	heard := polled
+	heard.PlannedArrivalTime, heard.CompiledArrivalTime = now.Add(time.Minute*4), now.Add(time.Minute*5)
+	p.live.add(heard)
+
+	assert.True(t, p.send(context.Background(), []arrivals.Bus{polled}, now))
+	want := []arrivals.Bus{heard, polled}
+	assert.Equal(t, want, <-out)
+	assert.Equal(t, want, p.st.Arrivals(), "what is shown, not only what was polled")
+	assert.Equal(t, 2, p.st.Health().Arrivals)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+)
+
+// reloader reads the config file every interval and passes it on when it changed.
+// A config that does not parse or validate is logged and skipped, so the old one
+// stays in effect until the file is fixed.
+type reloader struct {
+	path  string
+	every time.Duration
+	clock clock.Clock
+	log   *logger.Logger
+	out   chan<- config.Config
+
+	last   []byte // the contents last seen
+	failed bool   // whether the file could not be read last time
+}
+
+// run checks the config file until ctx is done.
+func (r *reloader) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(r.every):
+		}
+
+		cfg, ok := r.check()
+		if !ok {
+			continue
+		}
+		select {
+		case r.out <- cfg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check reads the config file and returns it when it changed and is valid.
+func (r *reloader) check() (config.Config, bool) {
+	b, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		// Editors may replace the file, so it can be missing for a moment.
+		if !r.failed {
+			r.log.Warn("could not read config", "config", r.path, "err", err)
+		}
+		r.failed = true
+		return config.Config{}, false
+	}
+	r.failed = false
+
+	if bytes.Equal(b, r.last) {
+		return config.Config{}, false
+	}
+	r.last = b
+
+	cfg, err := config.Parse(b)
+	if err != nil {
+		r.log.Warn("config changed but is invalid, keeping the old one", "config", r.path, "err", err)
+		return config.Config{}, false
+	}
+	r.log.Info("config changed", "config", r.path)
+	return cfg, true
+}
+
+// restartOnly returns the settings changed from cfg to next that are only applied
+// on a restart: the display is opened, and the boot animation played, once.
+func restartOnly(cfg, next config.Config) []string {
+	var changed []string
+	if next.Listen != cfg.Listen {
+		changed = append(changed, "listen")
+	}
+	if next.Log != cfg.Log {
+		changed = append(changed, "log")
+	}
+	if !reflect.DeepEqual(next.Panels, cfg.Panels) {
+		changed = append(changed, "panels") // with their rotation, flips and order
+	}
+	if next.BootAnimation != cfg.BootAnimation {
+		changed = append(changed, "boot_animation")
+	}
+	return changed
+}
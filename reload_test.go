@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+func TestReloaderCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+
+	write := func(s string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(s), 0644))
+	}
+	write(`{"line_number": "35"}`)
+
+	r := &reloader{path: path}
+	r.last, _ = ioutil.ReadFile(path)
+
+	_, ok := r.check()
+	assert.False(t, ok, "unchanged")
+
+	write(`{"line_number": "35", "poll_interval": "30s"}`)
+	cfg, ok := r.check()
+	assert.True(t, ok, "changed")
+	assert.Equal(t, time.Second*30, cfg.PollInterval.Duration)
+
+	write(`{"line_number": "35", "poll_interval": "1s"}`)
+	_, ok = r.check()
+	assert.False(t, ok, "invalid")
+
+	os.Remove(path)
+	_, ok = r.check()
+	assert.False(t, ok, "missing")
+
+	write(`{"line_number": "22"}`)
+	cfg, ok = r.check()
+	assert.True(t, ok, "fixed")
+	assert.Equal(t, "22", cfg.LineNumber)
+}
+
+func TestRestartOnly(t *testing.T) {
+	cfg := config.Default()
+	cfg.Panels = []config.Panel{{Socket: "/var/run/unicornd.socket"}, {Socket: "tcp://pi2:7777", X: 8}}
+
+	next := cfg
+	next.Panels = append([]config.Panel(nil), cfg.Panels...)
+	next.Mode, next.PollInterval.Duration = config.ModeClock, time.Minute
+	assert.Empty(t, restartOnly(cfg, next), "applied on a reload")
+
+	next.Panels[1].Rotation = 180
+	next.BootAnimation = "boot.gif"
+	next.Log.Level = "debug"
+	next.Listen = ":8080"
+	assert.Equal(t, []string{"listen", "log", "panels", "boot_animation"}, restartOnly(cfg, next))
+}
@@ -0,0 +1,227 @@
+// Package replay captures the raw OVAPI responses and websocket frames
+// to disk and plays them back on a virtual clock, optionally sped up,
+// so a day on the street can be debugged offline.
+//
+// A capture holds one JSON frame per line.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+)
+
+// Sources of frames.
+const (
+	SourceOVAPI     = "ovapi"
+	SourceWebsocket = "websocket"
+)
+
+// Frame is something received at a point in time.
+type Frame struct {
+	At     time.Time `json:"at"`
+	Source string    `json:"source"`
+	Status int       `json:"status,omitempty"` // HTTP status of OVAPI responses
+	URL    string    `json:"url,omitempty"`    // requested for OVAPI responses
+	Data   string    `json:"data"`             // verbatim
+}
+
+// Recorder appends frames to a capture.
+type Recorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	clock clock.Clock
+}
+
+// Create starts a new capture at path, timestamping frames with c.
+func Create(path string, c clock.Clock) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f, clock: c}, nil
+}
+
+// Write adds data received from source to the capture.
+func (r *Recorder) Write(source string, status int, data []byte) error {
+	return r.write(Frame{At: r.clock.Now(), Source: source, Status: status, Data: string(data)})
+}
+
+func (r *Recorder) write(fr Frame) error {
+	b, err := json.Marshal(fr)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.f.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the capture.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// Transport returns an http.RoundTripper capturing every response of next.
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+		fr := Frame{At: r.clock.Now(), Source: SourceOVAPI, Status: resp.StatusCode, URL: req.URL.String(), Data: string(b)}
+		if err := r.write(fr); err != nil {
+			return nil, fmt.Errorf("could not capture response: %v", err)
+		}
+		return resp, nil
+	})
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// Load reads the capture at path.
+func Load(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var frames []Frame
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16<<20) // OVAPI responses easily exceed the default 64KB
+	for s.Scan() {
+		var fr Frame
+		if err := json.Unmarshal(s.Bytes(), &fr); err != nil {
+			return nil, fmt.Errorf("could not parse capture %v line %d: %v", path, len(frames)+1, err)
+		}
+		frames = append(frames, fr)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("capture %v is empty", path)
+	}
+
+	return frames, nil
+}
+
+// Player plays a capture back on a virtual clock.
+type Player struct {
+	frames []Frame
+	clock  *clock.Virtual
+	done   chan struct{}
+}
+
+// NewPlayer starts playing frames, at speed times real time,
+// from the time of the first frame.
+func NewPlayer(frames []Frame, speed float64) *Player {
+	p := &Player{
+		frames: frames,
+		clock:  clock.NewVirtual(frames[0].At, speed),
+		done:   make(chan struct{}),
+	}
+
+	end := frames[len(frames)-1].At
+	go func() {
+		<-p.clock.After(end.Sub(p.clock.Now()))
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Clock returns the virtual clock the capture plays on.
+func (p *Player) Clock() clock.Clock {
+	return p.clock
+}
+
+// Done is closed when the last frame has been played.
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// Transport returns an http.RoundTripper answering every request with the last
+// OVAPI response to the same URL captured before the virtual now. Responses
+// captured without a URL answer any request.
+func (p *Player) Transport() http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		now := p.clock.Now()
+
+		var last *Frame
+		for i := range p.frames {
+			if p.frames[i].At.After(now) {
+				break
+			}
+			fr := &p.frames[i]
+			if fr.Source == SourceOVAPI && (fr.URL == "" || fr.URL == req.URL.String()) {
+				last = fr
+			}
+		}
+		if last == nil {
+			return nil, fmt.Errorf("no OVAPI response from %v captured before %v", req.URL, now.Format(time.RFC3339))
+		}
+
+		status := last.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(last.Data))),
+			Request:    req,
+		}, nil
+	})
+}
+
+// Websocket returns the captured websocket frames, each sent at its virtual time.
+// The channel is closed after the last one, or when ctx is done.
+func (p *Player) Websocket(ctx context.Context) <-chan []byte {
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+		for _, fr := range p.frames {
+			if fr.Source != SourceWebsocket {
+				continue
+			}
+			if wait := fr.At.Sub(p.clock.Now()); wait > 0 {
+				select {
+				case <-p.clock.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case ch <- []byte(fr.Data):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.jsonl")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"01346":{}}`))
+	}))
+	defer srv.Close()
+
+	rec, err := Create(path, clock.Real)
+	assert.NoError(t, err)
+	hc := &http.Client{Transport: rec.Transport(http.DefaultTransport)}
+	url := srv.URL + "/stopareacode/01346/departures"
+	resp, err := hc.Get(url)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `{"01346":{}}`, string(b))
+	assert.NoError(t, rec.Write(SourceWebsocket, 0, []byte(`[8,"/stops/01346","{}"]`)))
+	assert.NoError(t, rec.Close())
+
+	frames, err := Load(path)
+	assert.NoError(t, err)
+	if !assert.Len(t, frames, 2) {
+		return
+	}
+	assert.Equal(t, SourceOVAPI, frames[0].Source)
+	assert.Equal(t, http.StatusOK, frames[0].Status)
+	assert.Equal(t, url, frames[0].URL)
+
+	// Spread the frames out over an hour, played back in no time.
+	frames[1].At = frames[0].At.Add(time.Hour)
+	p := NewPlayer(frames, 3600*100)
+
+	hc = &http.Client{Transport: p.Transport()}
+	resp, err = hc.Get(url)
+	assert.NoError(t, err)
+	b, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"01346":{}}`, string(b))
+	_, err = hc.Get(srv.URL + "/stopareacode/01347/departures")
+	assert.Error(t, err)
+
+	ws := <-p.Websocket(context.Background())
+	assert.Equal(t, `[8,"/stops/01346","{}"]`, string(ws))
+	assert.False(t, p.Clock().Now().Before(frames[1].At))
+
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Error("replay did not finish")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/history"
+)
+
+// report prints the punctuality of the recorded arrivals, e.g.
+// `report -line 35 -since 168h`. It returns the exit code.
+func report(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	path := fs.String("history", cfg.History, "history file to report on")
+	line := fs.String("line", "", "only report on this line")
+	since := fs.Duration("since", 0, "only report on arrivals planned within this long ago, e.g. 168h")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "no history file, set `history` in the config or pass -history")
+		return 2
+	}
+
+	records, err := history.Load(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	from := time.Time{}
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	selected := records[:0]
+	for _, r := range records {
+		if (*line == "" || r.Line == *line) && !r.Target.Before(from) {
+			selected = append(selected, r)
+		}
+	}
+
+	if err := history.Print(os.Stdout, history.Report(selected, time.Local)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// evaluate tells whether correcting the ETAs would make them more accurate:
+// it learns from the oldest part of the history and tests on the rest, e.g.
+// `evaluate -train 0.7`. It returns the exit code.
+func evaluate(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	path := fs.String("history", cfg.History, "history file to learn from and test on")
+	train := fs.Float64("train", 0.7, "share of the history to learn from, the rest is tested on")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "no history file, set `history` in the config or pass -history")
+		return 2
+	}
+	if *train <= 0 || *train >= 1 {
+		fmt.Fprintln(os.Stderr, "train must be between 0 and 1")
+		return 2
+	}
+
+	records, err := history.Load(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Records are ordered by planned arrival, so the model never learns from the future.
+	n := int(float64(len(records)) * *train)
+	if err := history.PrintAccuracy(os.Stdout, history.Evaluate(records[:n], records[n:], time.Local)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
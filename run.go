@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/brightness"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/gtfs"
+	"gitlab.org/go-unicord-phat-lucian/history"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/mapsgvbnl"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+	"gitlab.org/go-unicord-phat-lucian/replay"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// openDisplay connects to unicornd, or to every panel of the config, or emulates
+// the display on stdout. It sets the size of the logical display to match.
+func openDisplay(emulate bool, cfg config.Config, log *logger.Logger) (unicorn.Display, error) {
+	if len(cfg.Panels) == 0 {
+		displayWidth, displayHeight = displayTransform.Size()
+		if emulate {
+			return unicorn.NewTerminal(os.Stdout, displayWidth, displayHeight), nil
+		}
+
+		c := unicorn.NewClient(log, "")
+		c.Transform = displayTransform
+		if err := c.Connect(); err != nil {
+			return nil, fmt.Errorf("could not connect to unicornd: %v", err)
+		}
+		return c, nil
+	}
+
+	c := newComposite(cfg.Panels, log)
+	displayWidth, displayHeight = c.Width, c.Height
+	if emulate {
+		return unicorn.NewTerminal(os.Stdout, c.Width, c.Height), nil
+	}
+	if err := c.Connect(); err != nil {
+		return nil, fmt.Errorf("could not connect to unicornd: %v", err)
+	}
+	return c, nil
+}
+
+// closeDisplay leaves every panel of d dark rather than frozen on the last frame,
+// and closes it. Anything drawing on d must have stopped.
+func closeDisplay(d unicorn.Display, log *logger.Logger) {
+	if err := d.Clear(); err != nil {
+		log.Warn("could not clear display", "err", err)
+	}
+	if err := d.Close(); err != nil {
+		log.Warn("could not close display", "err", err)
+	}
+}
+
+// newComposite returns the sign made of panels, not yet connected.
+func newComposite(panels []config.Panel, log *logger.Logger) *unicorn.Composite {
+	var ps []unicorn.Panel
+	for _, p := range panels {
+		c := unicorn.NewClient(log, p.Socket)
+		c.Transform = unicorn.Transform{
+			Width:    p.Width,
+			Height:   p.Height,
+			Rotation: unicorn.Rotation(p.Rotation / 90),
+			FlipH:    p.FlipH,
+			FlipV:    p.FlipV,
+		}
+		if p.Order == config.OrderRowMajor {
+			c.Transform.Order = unicorn.RowMajor
+		}
+		ps = append(ps, unicorn.Panel{Client: c, X: p.X, Y: p.Y})
+	}
+	return unicorn.NewComposite(ps...)
+}
+
+// bootSprite returns the boot_animation, or a bus driving in when there is none
+// or it can not be loaded.
+func bootSprite(cfg config.Config, log *logger.Logger) unicorn.Sprite {
+	if cfg.BootAnimation == "" {
+		return bootAnimation()
+	}
+	s, err := unicorn.LoadSprite(cfg.BootAnimation, time.Second*3)
+	if err != nil {
+		log.Warn("could not load boot animation", "err", err)
+		return bootAnimation()
+	}
+	return s
+}
+
+// run shows the upcoming buses until the process is asked to stop, e.g.
+// `run -replay day.jsonl -speed 10`, applying changes to the config file at
+// configPath as they are made. It returns the exit code.
+func run(cfg config.Config, configPath string, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	capturePath := fs.String("record", "", "capture the OVAPI responses and websocket frames to this file")
+	replayPath := fs.String("replay", "", "play back a capture made with -record instead of going online")
+	speed := fs.Float64("speed", 1, "how many times faster than real time to play back")
+	emulate := fs.Bool("emulate", false, "draw on this terminal instead of the unicornd display")
+	reloadEvery := fs.Duration("reload", time.Second*5, "how often to check the config file for changes, 0 to never")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Everything stops when the process is asked to.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	level, _ := logger.ParseLevel(cfg.Log.Level) // checked by config.Validate
+	log := logger.New(os.Stderr, cfg.Log.Format, level)
+	log.Info("starting up", "watches", len(cfg.Watchlist()), "mode", cfg.Mode)
+
+	clk := clock.Real
+	oc := ovapi.NewClient(log)
+	oc.Every = cfg.RequestInterval.Duration
+	wc := mapsgvbnl.NewClient(log)
+	wc.Filtered = func(reason string) { passesFiltered.Inc(reason) }
+	var (
+		replayed  <-chan struct{}
+		replaying bool
+	)
+	switch {
+	case *replayPath != "":
+		frames, err := replay.Load(*replayPath)
+		if err != nil {
+			log.Error("could not load capture", "err", err)
+			return 1
+		}
+		log.Info("replaying", "capture", *replayPath, "from", frames[0].At, "speed", *speed)
+
+		player := replay.NewPlayer(frames, *speed)
+		clk = player.Clock()
+		oc.Clock = clk
+		oc.HTTP.Transport = player.Transport()
+		wc.Clock = clk
+		wc.Replay = player.Websocket
+		replayed = player.Done()
+
+		// Replayed passes are not new to the history.
+		cfg.History, cfg.Correct = "", false
+		replaying = true
+	case *capturePath != "":
+		capture, err := replay.Create(*capturePath, clk)
+		if err != nil {
+			log.Error("could not create capture", "err", err)
+			return 1
+		}
+		defer capture.Close()
+		log.Info("capturing", "capture", *capturePath)
+
+		oc.HTTP.Transport = capture.Transport(http.DefaultTransport)
+		wc.Record = func(frame []byte) {
+			if err := capture.Write(replay.SourceWebsocket, 0, frame); err != nil {
+				log.Warn("could not capture websocket frame", "err", err)
+			}
+		}
+	}
+
+	c, err := openDisplay(*emulate, cfg, log)
+	if err != nil {
+		log.Error("could not open display", "err", err)
+		return 1
+	}
+
+	bc := brightness.New(cfg.Brightness, clk, log)
+	bc.Update(c, clk.Now())
+	c.Clear()
+	<-clk.After(time.Second * 2)
+	log.Info("display ready, waiting for input")
+
+	var rec *history.Recorder
+	if cfg.History != "" {
+		var err error
+		if rec, err = history.Open(cfg.History); err != nil {
+			log.Error("could not open history", "err", err)
+			closeDisplay(c, log)
+			return 1
+		}
+	}
+
+	var tt *gtfs.Timetable
+	if cfg.Schedule.GTFS != "" {
+		log.Info("loading timetable", "gtfs", cfg.Schedule.GTFS, "stop", cfg.Schedule.StopCode)
+		var err error
+		if tt, err = gtfs.Load(cfg.Schedule.GTFS, cfg.Schedule.StopCode); err != nil {
+			log.Error("could not load timetable, running without", "err", err)
+		} else {
+			log.Info("loaded timetable", "stop_times", tt.Len())
+		}
+	}
+
+	sl := newSleeper(cfg.Sleep, clk, log)
+	st := &status{}
+	dataChan := make(chan []arrivals.Bus)
+	reloads := make(chan config.Config, 1)
+	sch := &scheduler{
+		c:     c,
+		cfg:   cfg,
+		sl:    sl,
+		in:    dataChan,
+		log:   log.With("component", "scheduler"),
+		clock: clk,
+	}
+	sch.animate(bootSprite(cfg, log), clk.Now())
+
+	p := &poller{
+		cfg:   cfg,
+		clock: clk,
+		oc:    oc,
+		tt:    tt,
+		rec:   rec,
+		bc:    bc,
+		sch:   sch,
+		sl:    sl,
+		st:    st,
+		live:  newLive(),
+		out:   dataChan,
+
+		reload: reloads,
+	}
+
+	// Tasks are stopped in the order they are listed here:
+	// first no new data comes in, then the display stops cycling.
+	tasks := []func(){
+		start(p.run),
+	}
+	listen := func(cfg config.Config) func() {
+		wc.Watches = websocketWatches(cfg)
+		return start(func(ctx context.Context) {
+			p.live.listen(ctx, wc)
+		})
+	}
+	var stopWebsocket func()
+	if cfg.Websocket {
+		stopWebsocket = listen(cfg)
+	}
+	tasks = append(tasks,
+		func() {
+			if stopWebsocket != nil {
+				stopWebsocket()
+			}
+		},
+		start(sch.run),
+		start(func(ctx context.Context) { bc.Run(ctx, c) }),
+		start(sl.watchButton),
+		start(sl.watchWakeAt),
+	)
+	if addr := cfg.Listen; addr != "" {
+		srv := &server{st: st, sch: sch, sl: sl, bc: bc, clock: clk, log: log.With("component", "http")}
+		tasks = append(tasks, start(func(ctx context.Context) { srv.serve(ctx, addr) }))
+	}
+
+	var changed <-chan config.Config
+	if configPath != "" && *reloadEvery > 0 {
+		ch := make(chan config.Config)
+		r := &reloader{path: configPath, every: *reloadEvery, clock: clock.Real, log: log, out: ch}
+		r.last, _ = ioutil.ReadFile(configPath)
+		tasks = append([]func(){start(r.run)}, tasks...)
+		changed = ch
+	}
+
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-replayed:
+			log.Info("replay finished")
+			running = false
+		case next := <-changed:
+			if replaying {
+				next.History, next.Correct = "", false
+			}
+			if changed := restartOnly(cfg, next); len(changed) > 0 {
+				log.Warn("only changes on a restart", "changed", strings.Join(changed, ", "))
+			}
+
+			// The poller picks up the newest config when it is done fetching.
+			select {
+			case <-reloads:
+			default:
+			}
+			reloads <- next
+			sch.SetConfig(next)
+			sl.setConfig(next.Sleep)
+			bc.SetConfig(next.Brightness)
+
+			// The websocket is subscribed to the stops of the watches when it connects.
+			if stopWebsocket != nil && (!next.Websocket || !reflect.DeepEqual(websocketWatches(next), websocketWatches(cfg))) {
+				stopWebsocket()
+				stopWebsocket = nil
+				p.live.reset()
+			}
+			if next.Websocket && stopWebsocket == nil {
+				stopWebsocket = listen(next)
+			}
+			cfg = next
+		}
+	}
+	stop()
+	log.Info("shutting down")
+	for _, stopTask := range tasks {
+		stopTask()
+	}
+	if p.rec != nil {
+		p.rec.Close()
+	}
+	closeDisplay(c, log)
+	log.Info("bye")
+	return 0
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+const (
+	frameInterval = time.Millisecond * 100 // how often the scheduler draws
+	busInterval   = time.Second * 2        // how long each bus is shown in cycle mode
+)
+
+// message is a temporary text shown instead of the buses.
+type message struct {
+	Text     string        `json:"text"`
+	Color    unicorn.Pixel `json:"-"`
+	Priority int           `json:"priority"`
+	Expires  time.Time     `json:"expires"`
+}
+
+// scheduler decides what is on the display:
+// messages first, then the buses in the current mode.
+type scheduler struct {
+	c     unicorn.Display
+	cfg   config.Config // guarded by mu, replaced by SetConfig
+	sl    *sleeper
+	in    <-chan []arrivals.Bus
+	log   *logger.Logger
+	clock clock.Clock
+
+	mu       sync.RWMutex
+	frame    *unicorn.Canvas // nil until the first one is shown
+	mode     string
+	paused   bool
+	blanked  bool
+	messages []message
+	alerts   []arrivals.Alert
+
+	// Drawing state, only used by run.
+	next      int
+	switched  time.Time
+	scrolling scroller
+	blank     bool
+	anim      *unicorn.Sprite // playing since animStart, nil when there is none
+	animStart time.Time
+	alerting  int       // index of the alert scrolling by in this round
+	round     bool      // whether a round of alerts is going on
+	alerted   time.Time // when the last round of alerts ended
+}
+
+// run draws a frame every frameInterval until ctx is done.
+func (s *scheduler) run(ctx context.Context) {
+	var (
+		buses    []arrivals.Bus
+		received time.Time
+	)
+
+	tick := s.clock.After(frameInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case buses = <-s.in:
+			received = s.clock.Now()
+			if s.anim != nil && s.anim.Loops == 0 {
+				s.anim = nil // would never end
+			}
+			s.next = 0
+			s.switched = time.Time{}
+		case <-tick:
+			tick = s.clock.After(frameInterval)
+		}
+
+		// Do not keep showing old data when fetching fails.
+		now := s.clock.Now()
+		if now.Sub(received) > s.config().PollInterval.Duration*2 {
+			buses = nil
+		}
+
+		s.draw(now, buses)
+	}
+}
+
+// draw shows whatever has priority at now.
+func (s *scheduler) draw(now time.Time, buses []arrivals.Bus) {
+	mode, icons := s.Mode(), s.config().Icons
+	s.mu.Lock()
+	paused, blanked := s.paused, s.blanked
+	msg, hasMsg := s.message(now)
+	alerts := s.alerts
+	s.mu.Unlock()
+
+	etas := etasOf(buses, now, s.marks())
+	switch {
+	case paused:
+		return
+	case hasMsg:
+		s.scroll("msg:"+msg.Text, []segment{{text: msg.Text, color: msg.Color}})
+	case s.animating(now):
+	case blanked || s.sl.Asleep(now, len(etas) > 0):
+		s.sleep()
+	case s.alertDue(now, alerts):
+		s.showAlert(now, alerts)
+	case mode == config.ModeClock:
+		s.scroll("clock:"+now.Format("15:04"), []segment{{text: now.Format("15:04"), color: unicorn.Pixel{R: 255, G: 255, B: 255}}})
+	case len(etas) == 0:
+		s.idle() // blank_when_idle blanks instead, as the sleeper is asleep
+	case mode == config.ModeMultiBus:
+		var (
+			segs []segment
+			key  string
+		)
+		for i, e := range etas {
+			text := fmt.Sprint(e.min)
+			if e.corrected {
+				text = "~" + text
+			}
+			if i < len(etas)-1 {
+				text += " "
+			}
+			c := e.color()
+			if e.mark != (unicorn.Pixel{}) {
+				c = e.mark
+			}
+			if g, ic := transportIcon(e.transport); icons && g != nil {
+				segs = append(segs, segment{glyph: g, color: ic})
+				key += e.transport
+			}
+			segs = append(segs, segment{text: text, color: c})
+			key += text
+		}
+		s.scroll("buses:"+key, segs)
+	default:
+		if now.Sub(s.switched) < busInterval {
+			return
+		}
+		s.switched = now
+		s.scrolling = scroller{}
+		frames := cycleFrames(etas, icons)
+		s.show(frames[s.next%len(frames)])
+		s.next++
+	}
+}
+
+// animate starts playing sp at now, instead of the buses.
+func (s *scheduler) animate(sp unicorn.Sprite, now time.Time) {
+	s.anim, s.animStart = &sp, now
+	s.scrolling = scroller{}
+	s.switched = time.Time{}
+}
+
+// animating shows the frame of the animation playing at now,
+// reporting whether it is still playing.
+func (s *scheduler) animating(now time.Time) bool {
+	if s.anim == nil {
+		return false
+	}
+	cv := newCanvas()
+	if !s.anim.Draw(cv, now.Sub(s.animStart), 0, 0) {
+		s.anim = nil
+		return false
+	}
+	s.showCanvas(cv)
+	return true
+}
+
+// message returns the most important message that has not expired.
+// The caller must hold s.mu.
+func (s *scheduler) message(now time.Time) (message, bool) {
+	live := s.messages[:0]
+	for _, m := range s.messages {
+		if now.Before(m.Expires) {
+			live = append(live, m)
+		}
+	}
+	s.messages = live
+
+	if len(live) == 0 {
+		return message{}, false
+	}
+	return live[0], true
+}
+
+// alertDue reports whether one of alerts is to scroll by at now. Every
+// alerts interval a round starts, in which each live alert scrolls by once.
+func (s *scheduler) alertDue(now time.Time, alerts []arrivals.Alert) bool {
+	live := liveAlerts(alerts, now)
+	switch {
+	case len(live) == 0:
+		s.round = false
+		return false
+	case !s.round && now.Sub(s.alerted) < s.config().Alerts.Interval.Duration:
+		return false
+	case !s.round:
+		s.round, s.alerting = true, 0
+	}
+
+	if s.alerting >= len(live) {
+		s.round, s.alerted = false, now
+		return false
+	}
+	return true
+}
+
+// showAlert scrolls the current alert of the round, moving on to the next one
+// once it has scrolled by.
+func (s *scheduler) showAlert(now time.Time, alerts []arrivals.Alert) {
+	a := liveAlerts(alerts, now)[s.alerting]
+	c := alertColor
+	if a.Calamity {
+		c = calamityColor
+	}
+	s.scroll("alert:"+a.ID, []segment{
+		{glyph: warningSign, color: c},
+		{text: " " + a.Text, color: unicorn.Pixel{R: 255, G: 255, B: 255}},
+	})
+
+	if s.scrolling.passes > 0 {
+		s.scrolling = scroller{}
+		s.alerting++
+	}
+}
+
+// liveAlerts returns the alerts in effect at now.
+func liveAlerts(alerts []arrivals.Alert, now time.Time) []arrivals.Alert {
+	var live []arrivals.Alert
+	for _, a := range alerts {
+		if a.Live(now) {
+			live = append(live, a)
+		}
+	}
+	return live
+}
+
+// sleep blanks the display once.
+func (s *scheduler) sleep() {
+	if s.blank {
+		return
+	}
+	s.log.Info("display blanked, waiting for new data")
+	s.scrolling = scroller{}
+	s.switched = time.Time{}
+	s.showCanvas(newCanvas())
+}
+
+// idle shows that no bus is coming.
+func (s *scheduler) idle() {
+	s.scrolling = scroller{}
+	s.switched = time.Time{}
+	s.show(idleFrame())
+}
+
+// scroll moves text identified by key one pixel to the left.
+func (s *scheduler) scroll(key string, segs []segment) {
+	s.switched = time.Time{}
+	s.showCanvas(s.scrolling.step(key, segs, displayWidth))
+}
+
+// Frame returns the top left 8x8 pixels of the logical display.
+func (s *scheduler) Frame() unicorn.Matrix {
+	return s.Canvas().Matrix(0, 0)
+}
+
+// Canvas returns a copy of the logical display.
+func (s *scheduler) Canvas() *unicorn.Canvas {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.frame == nil {
+		return newCanvas()
+	}
+	return s.frame.Window(0, 0, s.frame.Width, s.frame.Height)
+}
+
+// show draws m in the top left corner of the display, the rest stays off.
+func (s *scheduler) show(m unicorn.Matrix) {
+	cv := newCanvas()
+	cv.DrawMatrix(m, 0, 0)
+	s.showCanvas(cv)
+}
+
+// showCanvas puts cv on the display.
+func (s *scheduler) showCanvas(cv *unicorn.Canvas) {
+	s.blank = true
+	for _, p := range cv.Pix {
+		if p != (unicorn.Pixel{}) {
+			s.blank = false
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.frame = cv
+	s.mu.Unlock()
+
+	if err := s.c.SetCanvas(cv); err != nil {
+		s.log.Warn("could not set pixels", "err", err)
+		return
+	}
+	s.c.Show()
+	framesPushed.Inc()
+}
+
+// config returns the config currently in effect.
+func (s *scheduler) config() config.Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cfg
+}
+
+// SetConfig applies a reloaded config from the next frame on.
+// A mode set through SetMode stays in effect.
+func (s *scheduler) SetConfig(cfg config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg = cfg
+}
+
+// Mode returns the current display mode.
+func (s *scheduler) Mode() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.mode == "" {
+		return s.cfg.Mode
+	}
+	return s.mode
+}
+
+// SetMode switches between the display modes.
+func (s *scheduler) SetMode(mode string) error {
+	if !config.ValidMode(mode) {
+		return fmt.Errorf("mode must be one of %v, passed: %v", strings.Join(config.Modes, ", "), mode)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = mode
+
+	return nil
+}
+
+// Pause freezes the display on the current frame.
+func (s *scheduler) Pause(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = paused
+}
+
+// Blank turns the display off until it is unblanked.
+func (s *scheduler) Blank(blanked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blanked = blanked
+}
+
+// SetAlerts replaces the alerts shown in between the buses.
+func (s *scheduler) SetAlerts(alerts []arrivals.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts = alerts
+}
+
+// Push shows a message until it expires. Higher priorities go first,
+// equal priorities in the order they were pushed.
+func (s *scheduler) Push(m message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, m)
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].Priority > s.messages[j].Priority
+	})
+}
+
+// ClearMessages removes all messages.
+func (s *scheduler) ClearMessages() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
+
+// State returns the remote controllable settings.
+func (s *scheduler) State() (mode string, paused, blanked bool, messages []message) {
+	mode = s.Mode()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return mode, s.paused, s.blanked, append([]message(nil), s.messages...)
+}
+
+// eta is a bus as shown on the display.
+type eta struct {
+	min        int           // whole minutes until the bus arrives
+	leave      int           // whole minutes until leaving for the bus, min minus the walk time
+	corrected  bool          // adjusted by the learned bias
+	scheduled  bool          // from the timetable, no realtime data
+	mark       unicorn.Pixel // colour of the watch, off when unmarked
+	wheelchair bool          // the vehicle is wheelchair accessible
+	transport  string        // BUS, TRAM, METRO or BOAT, "" when unknown
+
+	approach *arrivals.Approach // how far the bus still has to go, when known
+}
+
+// color is the etaColor of the time left to leave, or scheduledColor without realtime data.
+func (e eta) color() unicorn.Pixel {
+	if e.scheduled {
+		return scheduledColor
+	}
+	return etaColor(e.leave)
+}
+
+// etasOf returns the buses sorted by when to leave for them, skipping buses
+// that can no longer be caught. Buses of watches in marks get their colour.
+func etasOf(buses []arrivals.Bus, now time.Time, marks map[string]unicorn.Pixel) []eta {
+	etas := make([]eta, 0, len(buses))
+	for _, bus := range buses {
+		d := bus.CompiledArrivalTime.Sub(now)
+		if d-bus.WalkTime < 0 {
+			continue
+		}
+		etas = append(etas, eta{
+			min:        int(d.Minutes()),
+			leave:      int((d - bus.WalkTime).Minutes()),
+			corrected:  bus.Corrected,
+			scheduled:  bus.Scheduled,
+			mark:       marks[bus.Watch],
+			wheelchair: bus.WheelchairAccessible == arrivals.Accessible,
+			transport:  bus.TransportType,
+			approach:   bus.Approach,
+		})
+	}
+	sort.SliceStable(etas, func(i, j int) bool {
+		return etas[i].leave < etas[j].leave
+	})
+
+	return etas
+}
+
+// marks returns the colours of the watches that have one.
+func (s *scheduler) marks() map[string]unicorn.Pixel {
+	marks := map[string]unicorn.Pixel{}
+	for _, w := range s.config().Watches {
+		if w.Color != nil {
+			marks[w.Name] = unicorn.Pixel{R: uint(w.Color.R), G: uint(w.Color.G), B: uint(w.Color.B)}
+		}
+	}
+	return marks
+}
+
+// etaColor tells how much of a hurry you should be in.
+func etaColor(min int) unicorn.Pixel {
+	switch {
+	case min <= 3:
+		return unicorn.Pixel{R: 255} // red
+	case min <= 5:
+		return unicorn.Pixel{R: 230, G: 150} // orange
+	case min < 10:
+		return unicorn.Pixel{G: 255} // green. Sweet spot.
+	default:
+		return unicorn.Pixel{R: 255, G: 255, B: 255}
+	}
+}
+
+// render draws the minutes until a bus arrives, in scheduledColor when
+// there is no realtime data, with a dot in between the digits when the ETA was corrected,
+// one next to it when the vehicle is wheelchair accessible and a bar above it in the colour of the watch.
+func render(e eta) unicorn.Matrix {
+	cv := newCanvas()
+	num, p := e.min, e.color()
+
+	switch {
+	case num >= 0 && num <= 5:
+		drawDigit(cv, num, 0, p)
+	case num > 5 && num < 10:
+		drawDigit(cv, num, 5, p)
+	case num >= 10 && num < 100:
+		drawDigit(cv, num/10, 0, p)
+		drawDigit(cv, num%10, 5, p)
+	default:
+		unicorn.DrawGlyph(cv, exclamationMark, 0, 0, unicorn.Pixel{R: 255})
+		return cv.Matrix(0, 0)
+	}
+
+	if e.corrected {
+		cv.Set(3, 3, correctedMark)
+	}
+	if e.wheelchair {
+		cv.Set(4, 3, wheelchairMark)
+	}
+	if e.mark != (unicorn.Pixel{}) {
+		cv.Set(3, 0, e.mark)
+		cv.Set(4, 0, e.mark)
+	}
+
+	return cv.Matrix(0, 0)
+}
+
+// cycleFrames returns the frames shown one after the other in cycle mode:
+// the ETA of each bus, preceded by the icon of the vehicle with icons,
+// and followed by how far it still has to go when known.
+func cycleFrames(etas []eta, icons bool) []unicorn.Matrix {
+	var frames []unicorn.Matrix
+	for _, e := range etas {
+		if m, ok := renderIcon(e.transport); icons && ok {
+			frames = append(frames, m)
+		}
+		frames = append(frames, render(e))
+		if e.approach != nil {
+			frames = append(frames, renderApproach(*e.approach, e.color()))
+		}
+	}
+	return frames
+}
+
+// renderIcon draws the icon of transport in its colour in the middle of the display.
+func renderIcon(transport string) (unicorn.Matrix, bool) {
+	g, p := transportIcon(transport)
+	if g == nil {
+		return unicorn.Matrix{}, false
+	}
+	cv := newCanvas()
+	unicorn.DrawGlyph(cv, g, (cv.Width-len(g[0]))/2, (cv.Height-len(g))/2, p)
+	return cv.Matrix(0, 0), true
+}
+
+// renderApproach draws the bus a.Stops stops away from the pole of the stop on the right.
+// Each pixel of the road along the bottom is a stop, lit in p behind the bus.
+func renderApproach(a arrivals.Approach, p unicorn.Pixel) unicorn.Matrix {
+	cv := newCanvas()
+	w, h := cv.Width, cv.Height
+
+	for y := 0; y < h; y++ {
+		cv.Set(w-1, y, stopPoleColor)
+	}
+
+	// The bus is two pixels wide, right next to the pole when it is at the stop.
+	x := w - 3 - a.Stops
+	if x < 0 {
+		x = 0
+	}
+	for i := 0; i < w-1; i++ {
+		c := roadColor
+		if i < x {
+			c = p
+		}
+		cv.Set(i, h-1, c)
+	}
+	for _, dx := range []int{0, 1} {
+		cv.Set(x+dx, h-3, p)
+		cv.Set(x+dx, h-2, p)
+	}
+
+	return cv.Matrix(0, 0)
+}
+
+// segment is a piece of text, or a glyph, in one color.
+type segment struct {
+	text  string
+	glyph []string
+	color unicorn.Pixel
+}
+
+// width returns how wide seg is drawn, with the space after it.
+func (seg segment) width() int {
+	if seg.glyph != nil {
+		return len(seg.glyph[0]) + 1
+	}
+	if seg.text == "" {
+		return 0
+	}
+	return unicorn.TextWidth(seg.text) + 1
+}
+
+// scroller moves text from right to left over the display.
+type scroller struct {
+	key    string
+	cv     *unicorn.Canvas
+	x      int
+	passes int // how often the text scrolled by completely
+}
+
+// step returns the next frame of the text identified by key on a display w wide.
+// A new key starts scrolling in from the right.
+func (sc *scroller) step(key string, segs []segment, w int) *unicorn.Canvas {
+	if sc.key != key || sc.cv == nil {
+		width := 0
+		for _, seg := range segs {
+			width += seg.width()
+		}
+		if width > 0 {
+			width-- // no space after the last segment
+		}
+
+		sc.key = key
+		sc.cv = unicorn.NewCanvas(width, unicorn.FontHeight)
+		sc.x = -w
+		sc.passes = 0
+
+		x := 0
+		for _, seg := range segs {
+			if seg.glyph != nil {
+				unicorn.DrawGlyph(sc.cv, seg.glyph, x, 0, seg.color)
+				x += seg.width()
+				continue
+			}
+			x = unicorn.DrawText(sc.cv, x, 0, seg.text, seg.color)
+		}
+	}
+
+	// Center the text on displays taller than the font.
+	m := sc.cv.Window(sc.x, -(displayHeight-unicorn.FontHeight)/2, w, displayHeight)
+
+	sc.x++
+	if sc.x > sc.cv.Width {
+		sc.x = -w
+		sc.passes++
+	}
+	return m
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// newTestScheduler returns a scheduler of cfg drawing on a terminal,
+// on a fake clock at noon.
+func newTestScheduler(t *testing.T, cfg config.Config) (*scheduler, *clock.Fake) {
+	t.Helper()
+
+	w, h := displayTransform.Size()
+	clk := clock.NewFake(time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC))
+	return &scheduler{
+		c:     unicorn.NewTerminal(ioutil.Discard, w, h),
+		cfg:   cfg,
+		sl:    newSleeper(cfg.Sleep, clk, nil),
+		clock: clk,
+	}, clk
+}
+
+func TestSchedulerCycles(t *testing.T) {
+	s, clk := newTestScheduler(t, config.Default())
+	start := clk.Now()
+
+	buses := []arrivals.Bus{
+		{CompiledArrivalTime: start.Add(time.Minute*7 + time.Second*30)},
+		{CompiledArrivalTime: start.Add(time.Minute * 3)},
+	}
+
+	tests := []struct {
+		at   time.Duration // since start
+		want int           // minutes shown
+	}{
+		{0, 3},
+		{time.Second, 3},
+		{busInterval - frameInterval, 3},
+		{busInterval, 7},
+		{busInterval*2 - frameInterval, 7},
+		{busInterval * 2, 2}, // the 3 minutes have started ticking down
+		{time.Minute * 5, 2}, // the first bus is gone
+		{time.Minute*5 + busInterval, 2},
+	}
+	for _, tt := range tests {
+		clk.Set(start.Add(tt.at))
+		s.draw(clk.Now(), buses)
+		assert.Equal(t, render(eta{min: tt.want, leave: tt.want}), s.Frame(), "at %v", tt.at)
+	}
+}
+
+func TestSchedulerAlerts(t *testing.T) {
+	s, clk := newTestScheduler(t, config.Default())
+	start := clk.Now()
+	s.SetAlerts([]arrivals.Alert{
+		{ID: "a", Text: "omleiding", Start: start.Add(-time.Hour)},
+		{ID: "b", Text: "storing", Start: start.Add(-time.Hour), End: start.Add(time.Minute * 2)},
+	})
+	buses := []arrivals.Bus{{CompiledArrivalTime: start.Add(time.Minute * 5)}}
+	bus := func() unicorn.Matrix {
+		min := int(buses[0].CompiledArrivalTime.Sub(clk.Now()).Minutes())
+		return render(eta{min: min, leave: min})
+	}
+
+	// Draws until the buses show up again, returning the alerts that scrolled by.
+	round := func() []string {
+		var shown []string
+		for i := 0; i < 1000; i++ {
+			s.draw(clk.Now(), buses)
+			if s.Frame() == bus() {
+				return shown
+			}
+			if id := s.scrolling.key; id != "" && (len(shown) == 0 || shown[len(shown)-1] != id) {
+				shown = append(shown, id)
+			}
+			clk.Advance(frameInterval)
+		}
+		t.Fatal("alerts never ended")
+		return nil
+	}
+
+	assert.Equal(t, []string{"alert:a", "alert:b"}, round(), "each scrolls by once")
+
+	clk.Advance(time.Second * 30)
+	s.draw(clk.Now(), buses)
+	assert.Equal(t, bus(), s.Frame(), "not again within the interval")
+
+	clk.Advance(time.Minute * 2)
+	assert.Equal(t, []string{"alert:a"}, round(), "b expired")
+
+	s.SetAlerts(nil)
+	clk.Advance(time.Minute)
+	s.draw(clk.Now(), buses)
+	assert.Equal(t, bus(), s.Frame(), "dismissed")
+}
+
+func TestSchedulerIdle(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sleep.BlankWhenIdle = false
+
+	// Without buses it says so, unless blank_when_idle.
+	s, clk := newTestScheduler(t, cfg)
+	start := clk.Now()
+	s.draw(start, nil)
+	assert.Equal(t, idleFrame(), s.Frame())
+	assert.NotEqual(t, unicorn.Matrix{}, s.Frame())
+
+	cfg.Sleep.BlankWhenIdle = true
+	s, _ = newTestScheduler(t, cfg)
+	s.draw(start, []arrivals.Bus{{CompiledArrivalTime: start.Add(time.Minute * 5)}})
+	assert.Equal(t, render(eta{min: 5, leave: 5}), s.Frame())
+	s.draw(start.Add(busInterval), nil)
+	assert.Equal(t, unicorn.Matrix{}, s.Frame())
+}
+
+func TestSchedulerAnimates(t *testing.T) {
+	s, clk := newTestScheduler(t, config.Default())
+	start := clk.Now()
+	buses := []arrivals.Bus{{CompiledArrivalTime: start.Add(time.Minute * 5)}}
+
+	boot := bootAnimation()
+	s.animate(boot, start)
+	for at := time.Duration(0); at < boot.Length(); at += frameInterval {
+		clk.Set(start.Add(at))
+		s.draw(clk.Now(), buses)
+
+		f, _ := boot.FrameAt(at)
+		var want unicorn.Matrix
+		f.DrawMatrix(&want, 0, 0)
+		assert.Equal(t, want, s.Frame(), "at %v", at)
+	}
+
+	// The bus drove in, then the buses are shown.
+	clk.Set(start.Add(boot.Length()))
+	s.draw(clk.Now(), buses)
+	assert.Nil(t, s.anim)
+	assert.Equal(t, render(eta{min: 4, leave: 4}), s.Frame())
+}
+
+func TestEtasOf(t *testing.T) {
+	now := time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC)
+	tram := unicorn.Pixel{B: 255}
+	buses := []arrivals.Bus{
+		{Watch: "bus", CompiledArrivalTime: now.Add(time.Minute * 6)},
+		{Watch: "tram", TransportType: arrivals.TransportTram, CompiledArrivalTime: now.Add(time.Minute * 9), WalkTime: time.Minute * 5},
+		{Watch: "tram", CompiledArrivalTime: now.Add(time.Minute * 4), WalkTime: time.Minute * 5},
+	}
+
+	// The tram in 9 minutes is 5 minutes away, so it is left for first.
+	// The one in 4 minutes can not be caught.
+	assert.Equal(t, []eta{
+		{min: 9, leave: 4, mark: tram, transport: arrivals.TransportTram},
+		{min: 6, leave: 6},
+	}, etasOf(buses, now, map[string]unicorn.Pixel{"tram": tram}))
+}
+
+func TestRenderMarks(t *testing.T) {
+	m := render(eta{min: 12, leave: 12, corrected: true, wheelchair: true, mark: unicorn.Pixel{B: 255}})
+	assert.Equal(t, correctedMark, m[3][3])
+	assert.Equal(t, wheelchairMark, m[4][3])
+	assert.Equal(t, unicorn.Pixel{B: 255}, m[3][0])
+
+	m = render(eta{min: 12, leave: 12})
+	assert.Equal(t, unicorn.Pixel{}, m[4][3])
+}
+
+func TestCycleFramesIcons(t *testing.T) {
+	etas := []eta{{min: 3, leave: 3, transport: arrivals.TransportTram}, {min: 7, leave: 7}}
+	assert.Len(t, cycleFrames(etas, false), 2)
+
+	// Only the tram has an icon, in the middle of the display.
+	frames := cycleFrames(etas, true)
+	if assert.Len(t, frames, 3) {
+		icon, ok := renderIcon(arrivals.TransportTram)
+		assert.True(t, ok)
+		assert.Equal(t, icon, frames[0])
+		assert.Equal(t, render(etas[0]), frames[1])
+		assert.Equal(t, transportColors[arrivals.TransportTram], icon[3][0])
+		assert.Equal(t, unicorn.Pixel{}, icon[7][0])
+	}
+
+	_, ok := renderIcon("")
+	assert.False(t, ok)
+}
+
+func TestRenderApproach(t *testing.T) {
+	bus := unicorn.Pixel{G: 255}
+	row := func(m unicorn.Matrix, y int) string {
+		w, _ := displayTransform.Size()
+		out := ""
+		for x := 0; x < w; x++ {
+			switch m[x][y] {
+			case bus:
+				out += "#"
+			case roadColor:
+				out += "-"
+			case stopPoleColor:
+				out += "|"
+			default:
+				out += "."
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		stops int
+		want  []string
+	}{
+		{0, []string{".......|", ".....##|", ".....##|", "#####--|"}},
+		{2, []string{".......|", "...##..|", "...##..|", "###----|"}},
+		{9, []string{".......|", "##.....|", "##.....|", "-------|"}},
+	}
+	for _, tt := range tests {
+		m := renderApproach(arrivals.Approach{Stops: tt.stops}, bus)
+		var got []string
+		for y := 0; y < 4; y++ {
+			got = append(got, row(m, y))
+		}
+		assert.Equal(t, tt.want, got, "%d stops", tt.stops)
+	}
+}
+
+func TestNewComposite(t *testing.T) {
+	c := newComposite([]config.Panel{
+		{Socket: "/var/run/unicornd.socket", Width: 8, Height: 4, Rotation: 180, Order: config.OrderRowMajor},
+		{Socket: "tcp://pi2:7777", X: 8, Width: 8, Height: 4, FlipH: true},
+	}, nil)
+	assert.Equal(t, 16, c.Width)
+	assert.Equal(t, 4, c.Height)
+	assert.Equal(t, displayTransform, c.Panels[0].Client.Transform)
+	assert.Equal(t, "tcp://pi2:7777", c.Panels[1].Client.Path)
+	assert.Equal(t, 8, c.Panels[1].X)
+	assert.True(t, c.Panels[1].Client.Transform.FlipH)
+}
+
+func TestScrollerPanels(t *testing.T) {
+	defer func(w, h int) { displayWidth, displayHeight = w, h }(displayWidth, displayHeight)
+	displayWidth, displayHeight = 16, 4
+
+	// The text comes in on the right panel and leaves over the left one.
+	var sc scroller
+	segs := []segment{{text: "1", color: etaColor(3)}}
+	var left, right bool
+	for sc.passes == 0 {
+		cv := sc.step("1", segs, displayWidth)
+		assert.Equal(t, 16, cv.Width)
+		assert.Equal(t, 4, cv.Height)
+		for x := 0; x < cv.Width; x++ {
+			for y := 0; y < cv.Height; y++ {
+				if cv.At(x, y) != (unicorn.Pixel{}) {
+					left, right = left || x < 8, right || x >= 8
+				}
+			}
+		}
+	}
+	assert.True(t, left)
+	assert.True(t, right)
+}
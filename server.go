@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/brightness"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+	"gitlab.org/go-unicord-phat-lucian/metrics"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// server is the local HTTP server, used to check on
+// and control the display from a phone.
+type server struct {
+	st    *status
+	sch   *scheduler
+	sl    *sleeper
+	bc    *brightness.Controller
+	clock clock.Clock
+	log   *logger.Logger
+}
+
+// arrival is a bus as served on /arrivals.
+type arrival struct {
+	arrivals.Bus
+	ETASeconds int `json:"eta_seconds"`
+}
+
+// frame is the display as served on /frame, one `#rrggbb` per pixel.
+type frame struct {
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Rows   [][]string `json:"rows"`
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/arrivals", s.handleArrivals)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/frame", s.handleFrame)
+	mux.HandleFunc("/wake", s.handleWake)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/control", s.handleControl)
+	mux.HandleFunc("/control/brightness", s.handleBrightness)
+	mux.HandleFunc("/control/mode", s.handleMode)
+	mux.HandleFunc("/control/pause", s.handlePause)
+	mux.HandleFunc("/control/blank", s.handleBlank)
+	mux.HandleFunc("/control/message", s.handleMessage)
+	return mux
+}
+
+// serve runs the HTTP server on addr until ctx is done.
+func (s *server) serve(ctx context.Context, addr string) {
+	srv := &http.Server{Addr: addr, Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Info("listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.log.Error("HTTP server stopped", "err", err)
+	}
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardHTML)
+}
+
+func (s *server) handleArrivals(w http.ResponseWriter, r *http.Request) {
+	now := s.clock.Now()
+	out := make([]arrival, 0)
+	for _, bus := range s.st.Arrivals() {
+		out = append(out, arrival{
+			Bus:        bus,
+			ETASeconds: int(bus.CompiledArrivalTime.Sub(now).Seconds()),
+		})
+	}
+	s.writeJSON(w, out)
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.st.Health())
+}
+
+// handleFrame serves the display as JSON, or as PNG with `?format=png`.
+func (s *server) handleFrame(w http.ResponseWriter, r *http.Request) {
+	cv := s.sch.Canvas()
+
+	if r.URL.Query().Get("format") == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, frameImage(cv))
+		return
+	}
+
+	f := frame{Width: cv.Width, Height: cv.Height}
+	for y := 0; y < cv.Height; y++ {
+		row := make([]string, cv.Width)
+		for x := 0; x < cv.Width; x++ {
+			row[x] = cv.At(x, y).Hex()
+		}
+		f.Rows = append(f.Rows, row)
+	}
+	s.writeJSON(w, f)
+}
+
+func (s *server) handleWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	s.log.Info("woken up over HTTP")
+	s.sl.Wake(s.clock.Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// frameImage draws every pixel of cv as a 16x16 block with a dark border.
+func frameImage(cv *unicorn.Canvas) image.Image {
+	const size = 16
+
+	img := image.NewRGBA(image.Rect(0, 0, cv.Width*size, cv.Height*size))
+	for x := 0; x < cv.Width*size; x++ {
+		for y := 0; y < cv.Height*size; y++ {
+			c := color.RGBA{A: 255}
+			if x%size != 0 && y%size != 0 {
+				p := cv.At(x/size, y/size)
+				c = color.RGBA{R: uint8(p.R), G: uint8(p.G), B: uint8(p.B), A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Warn("could not write response", "err", err)
+	}
+}
+
+// dashboardHTML mirrors the LED panel and lists the upcoming buses.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Next GVB bus</title>
+<style>
+body { background: #111; color: #ddd; font-family: sans-serif; margin: 1em; }
+#panel { display: inline-grid; gap: 4px; padding: 8px; background: #000; border-radius: 6px; }
+#panel div { width: 28px; height: 28px; border-radius: 50%; }
+table { border-collapse: collapse; margin-top: 1em; }
+td, th { padding: 4px 10px; text-align: left; }
+.late { color: #f66; }
+#health { color: #888; font-size: small; margin-top: 1em; }
+</style>
+</head>
+<body>
+<div id="panel"></div>
+<table>
+<thead><tr><th>Watch</th><th>Line</th><th>Destination</th><th>ETA</th><th>Delay</th><th>Status</th><th>Wheelchair</th></tr></thead>
+<tbody id="arrivals"></tbody>
+</table>
+<div id="health"></div>
+<script>
+function get(path, fn) {
+  fetch(path).then(function (r) { return r.json(); }).then(fn).catch(function () {});
+}
+
+function wheelchair(v) {
+  return v === 'ACCESSIBLE' ? 'yes' : v === 'NOTACCESSIBLE' ? 'no' : '';
+}
+
+function vehicle(v) {
+  return { BUS: 'bus ', TRAM: 'tram ', METRO: 'metro ', BOAT: 'ferry ' }[v] || '';
+}
+
+function refresh() {
+  get('/frame', function (f) {
+    var panel = document.getElementById('panel');
+    panel.style.gridTemplateColumns = 'repeat(' + f.width + ', 28px)';
+    panel.innerHTML = '';
+    f.rows.forEach(function (row) {
+      row.forEach(function (c) {
+        var led = document.createElement('div');
+        led.style.background = c === '#000000' ? '#1a1a1a' : c;
+        panel.appendChild(led);
+      });
+    });
+  });
+
+  get('/arrivals', function (list) {
+    var body = document.getElementById('arrivals');
+    body.innerHTML = '';
+    list.forEach(function (a) {
+      var tr = document.createElement('tr');
+      [a.watch, vehicle(a.transport_type) + a.line_number, a.final_destination_name, (a.corrected ? '~' : '') + Math.floor(a.eta_seconds / 60) + ' min',
+       Math.round(a.delay_seconds / 60) + ' min', a.trip_status, wheelchair(a.wheelchair_accessible)].forEach(function (v, i) {
+        var td = document.createElement('td');
+        td.textContent = v;
+        if (i === 4 && a.delay_seconds >= 60) { td.className = 'late'; }
+        tr.appendChild(td);
+      });
+      body.appendChild(tr);
+    });
+  });
+
+  get('/health', function (h) {
+    document.getElementById('health').textContent =
+      'Source ' + h.source + ', last fetch ' + h.last_fetch + ', errors ' + h.errors +
+      (h.last_error ? ' (' + h.last_error + ')' : '');
+  });
+}
+
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
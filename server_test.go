@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+	"gitlab.org/go-unicord-phat-lucian/brightness"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/unicornphat"
+)
+
+// newTestServer returns a server of the default config
+// with a scheduler of newTestScheduler.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+
+	cfg := config.Default()
+	sch, clk := newTestScheduler(t, cfg)
+	return &server{
+		st:    &status{},
+		sch:   sch,
+		sl:    sch.sl,
+		bc:    brightness.New(cfg.Brightness, clk, nil),
+		clock: clk,
+	}
+}
+
+// request has s serve a request with body, which may be empty, and returns the response.
+func request(s *server, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestServerArrivals(t *testing.T) {
+	s := newTestServer(t)
+	now := s.clock.Now()
+
+	w := request(s, http.MethodGet, "/arrivals", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "[]\n", w.Body.String(), "a list, not null")
+
+	s.st.shown([]arrivals.Bus{{
+		Watch:               "bus",
+		LineNumber:          "35",
+		TransportType:       arrivals.TransportBus,
+		CompiledArrivalTime: now.Add(time.Minute*5 + time.Second*30),
+		DelaySeconds:        60,
+	}})
+	var got []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(request(s, http.MethodGet, "/arrivals", "").Body.Bytes(), &got))
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, "bus", got[0]["watch"])
+		assert.Equal(t, "35", got[0]["line_number"])
+		assert.Equal(t, "BUS", got[0]["transport_type"])
+		assert.Equal(t, float64(60), got[0]["delay_seconds"])
+		assert.Equal(t, float64(330), got[0]["eta_seconds"])
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	s := newTestServer(t)
+	now := s.clock.Now()
+	s.st.fetched("ovapi", nil, now)
+	s.st.shown(make([]arrivals.Bus, 3))
+	s.st.fetched("ovapi", errors.New("timeout"), now.Add(time.Minute))
+
+	var h health
+	assert.NoError(t, json.Unmarshal(request(s, http.MethodGet, "/health", "").Body.Bytes(), &h))
+	assert.Equal(t, "ovapi", h.Source)
+	assert.True(t, now.Equal(h.LastSuccess))
+	assert.True(t, now.Add(time.Minute).Equal(h.LastFetch))
+	assert.Equal(t, "timeout", h.LastError)
+	assert.Equal(t, 1, h.Errors)
+	assert.Equal(t, 3, h.Arrivals)
+}
+
+func TestServerFrame(t *testing.T) {
+	s := newTestServer(t)
+	cv := newCanvas()
+	cv.Set(0, 0, unicorn.Pixel{R: 255})
+	cv.Set(7, 3, unicorn.Pixel{R: 1, G: 2, B: 3})
+	s.sch.showCanvas(cv)
+
+	var f frame
+	w := request(s, http.MethodGet, "/frame", "")
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &f))
+	assert.Equal(t, 8, f.Width)
+	assert.Equal(t, 4, f.Height)
+	if assert.Len(t, f.Rows, 4) {
+		for _, row := range f.Rows {
+			assert.Len(t, row, 8)
+		}
+		assert.Equal(t, "#ff0000", f.Rows[0][0])
+		assert.Equal(t, "#010203", f.Rows[3][7])
+		assert.Equal(t, "#000000", f.Rows[3][0])
+	}
+
+	w = request(s, http.MethodGet, "/frame?format=png", "")
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	img, err := png.Decode(w.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8*16, img.Bounds().Dx())
+		assert.Equal(t, 4*16, img.Bounds().Dy())
+		rgba := func(x, y int) color.RGBA { return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA) }
+		assert.Equal(t, color.RGBA{R: 255, A: 255}, rgba(8, 8))
+		assert.Equal(t, color.RGBA{A: 255}, rgba(16, 8), "the border between two pixels")
+		assert.Equal(t, color.RGBA{R: 1, G: 2, B: 3, A: 255}, rgba(7*16+8, 3*16+8))
+	}
+}
+
+func TestServerRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	w := request(s, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<title>Next GVB bus</title>")
+
+	for _, path := range []string{"/nope", "/arrivals/35", "/index.html"} {
+		assert.Equal(t, http.StatusNotFound, request(s, http.MethodGet, path, "").Code, path)
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, request(s, http.MethodGet, "/wake", "").Code)
+	assert.Equal(t, http.StatusNoContent, request(s, http.MethodPost, "/wake", "").Code)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/logger"
+)
+
+// sleeper decides when the display is blanked.
+// It sleeps during quiet hours and, optionally, when no bus is coming.
+type sleeper struct {
+	clock clock.Clock
+	log   *logger.Logger
+
+	mu         sync.Mutex
+	cfg        config.Sleep
+	awakeUntil time.Time
+
+	// woken receives a value whenever the display is woken up,
+	// so fresh data can be fetched straight away.
+	woken chan struct{}
+}
+
+func newSleeper(cfg config.Sleep, clk clock.Clock, log *logger.Logger) *sleeper {
+	return &sleeper{
+		cfg:   cfg,
+		clock: clk,
+		log:   log.With("component", "sleep"),
+		woken: make(chan struct{}, 1),
+	}
+}
+
+// config returns the sleep config currently in effect.
+func (s *sleeper) config() config.Sleep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cfg
+}
+
+// setConfig applies a reloaded sleep config. A display woken up stays awake.
+func (s *sleeper) setConfig(cfg config.Sleep) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg = cfg
+}
+
+// Wake keeps the display on for the configured wake_for.
+func (s *sleeper) Wake(now time.Time) {
+	s.mu.Lock()
+	s.awakeUntil = now.Add(s.cfg.WakeFor.Duration)
+	s.mu.Unlock()
+
+	select {
+	case s.woken <- struct{}{}:
+	default:
+	}
+}
+
+// Asleep reports whether the display should be blank at now.
+func (s *sleeper) Asleep(now time.Time, hasArrivals bool) bool {
+	s.mu.Lock()
+	awake, cfg := now.Before(s.awakeUntil), s.cfg
+	s.mu.Unlock()
+	if awake {
+		return false
+	}
+
+	if wokenAt(cfg, now) {
+		return false
+	}
+
+	c := config.Of(now)
+	for _, p := range cfg.QuietHours {
+		if p.Contains(c) {
+			return true
+		}
+	}
+
+	return cfg.BlankWhenIdle && !hasArrivals
+}
+
+const day = config.Clock(time.Hour * 24)
+
+// wokenAt reports whether now is in a wake_at period of cfg.
+func wokenAt(cfg config.Sleep, now time.Time) bool {
+	c := config.Of(now)
+	for _, at := range cfg.WakeAt {
+		woken := config.Period{From: at, To: (at + config.Clock(cfg.WakeFor.Duration)) % day}
+		if woken.Contains(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchWakeAt signals woken whenever a wake_at period starts until ctx is done,
+// so fresh data is fetched for it. It looks at least every minute, for a reloaded config.
+func (s *sleeper) watchWakeAt(ctx context.Context) {
+	was := wokenAt(s.config(), s.clock.Now())
+	for {
+		wait := time.Minute
+		c := config.Of(s.clock.Now())
+		for _, at := range s.config().WakeAt {
+			if until := time.Duration((at - c + day) % day); until > 0 && until < wait {
+				wait = until
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-s.clock.After(wait):
+			is := wokenAt(s.config(), now)
+			if is && !was {
+				s.log.Info("waking up display at wake_at")
+				select {
+				case s.woken <- struct{}{}:
+				default:
+				}
+			}
+			was = is
+		}
+	}
+}
+
+// watchButton polls the sysfs value of a GPIO and wakes the display on a press
+// until ctx is done. Without a button it checks every second whether one was configured.
+func (s *sleeper) watchButton(ctx context.Context) {
+	last := false
+	for {
+		wait := time.Millisecond * 50
+
+		cfg := s.config()
+		pressed := "1"
+		if cfg.ButtonActiveLow {
+			pressed = "0"
+		}
+
+		if cfg.Button == "" {
+			wait, last = time.Second, false
+		} else if b, err := ioutil.ReadFile(cfg.Button); err != nil {
+			s.log.Warn("could not read button", "button", cfg.Button, "err", err)
+			wait = time.Second * 10
+		} else {
+			down := strings.TrimSpace(string(b)) == pressed
+			if down && !last {
+				s.log.Info("button pressed, waking up display")
+				s.Wake(s.clock.Now())
+			}
+			last = down
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(wait):
+		}
+	}
+}
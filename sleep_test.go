@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/clock"
+	"gitlab.org/go-unicord-phat-lucian/config"
+)
+
+func TestSleeperAsleep(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2019, 1, 2, h, m, 0, 0, time.UTC) }
+	clk := func(h, m int) config.Clock { return config.Of(at(h, m)) }
+	night := config.Sleep{
+		QuietHours: []config.Period{{From: clk(23, 0), To: clk(6, 30)}},
+		WakeAt:     []config.Clock{clk(5, 50), clk(23, 55)},
+		WakeFor:    config.Duration{Duration: time.Minute * 15},
+	}
+	idle := night
+	idle.BlankWhenIdle = true
+
+	tests := []struct {
+		name    string
+		cfg     config.Sleep
+		now     time.Time
+		arrival bool
+		want    bool
+	}{
+		{"day", night, at(12, 0), true, false},
+		{"day without buses", night, at(12, 0), false, false},
+		{"day without buses, blank when idle", idle, at(12, 0), false, true},
+		{"day with buses, blank when idle", idle, at(12, 0), true, false},
+		{"quiet before midnight", night, at(23, 0), true, true},
+		{"quiet after midnight", night, at(3, 0), true, true},
+		{"quiet hours end", night, at(6, 30), true, false},
+		{"woken at", night, at(5, 50), true, false},
+		{"woken for", night, at(6, 4), true, false},
+		{"woken for over", night, at(6, 5), true, true},
+		{"woken across midnight", night, at(0, 9), true, false},
+		{"woken across midnight over", night, at(0, 10), true, true},
+		{"woken without buses, blank when idle", idle, at(5, 55), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSleeper(tt.cfg, clock.NewFake(tt.now), nil)
+			assert.Equal(t, tt.want, s.Asleep(tt.now, tt.arrival))
+		})
+	}
+
+	// A press wakes it up during quiet hours for wake_for.
+	s := newSleeper(night, clock.NewFake(at(2, 0)), nil)
+	s.Wake(at(2, 0))
+	assert.False(t, s.Asleep(at(2, 14), true))
+	assert.True(t, s.Asleep(at(2, 15), true))
+	select {
+	case <-s.woken:
+	default:
+		t.Error("wake did not signal woken")
+	}
+}
+
+func TestSleeperWatchWakeAt(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2019, 1, 2, h, m, 0, 0, time.UTC) }
+	cfg := config.Sleep{
+		QuietHours: []config.Period{{From: config.Of(at(23, 0)), To: config.Of(at(6, 30))}},
+		WakeAt:     []config.Clock{config.Of(at(5, 50))},
+		WakeFor:    config.Duration{Duration: time.Minute * 15},
+	}
+	clk := clock.NewFake(at(5, 45))
+	s := newSleeper(cfg, clk, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchWakeAt(ctx)
+
+	// Moves the clock on until woken, to a minute before the end of wake_for.
+	woken := func() bool {
+		for clk.Now().Before(at(6, 4)) {
+			select {
+			case <-s.woken:
+				return true
+			case <-time.After(time.Millisecond):
+				clk.Advance(time.Second * 5)
+			}
+		}
+		return false
+	}
+	assert.True(t, woken())
+	assert.False(t, clk.Now().Before(at(5, 50)), "woken at %v", clk.Now())
+	assert.False(t, s.Asleep(clk.Now(), true))
+	assert.False(t, woken(), "once a period")
+}
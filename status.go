@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/arrivals"
+)
+
+// status keeps track of what the display currently knows,
+// so it can be inspected over HTTP.
+type status struct {
+	mu sync.RWMutex
+
+	source      string
+	arrivals    []arrivals.Bus
+	lastFetch   time.Time
+	lastSuccess time.Time
+	lastError   string
+	errors      int
+}
+
+// health is the JSON served on /health.
+type health struct {
+	Source      string    `json:"source"`
+	LastFetch   time.Time `json:"last_fetch"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	Errors      int       `json:"errors"`
+	Arrivals    int       `json:"arrivals"`
+}
+
+// fetched records the outcome of a fetch from source.
+// The buses are recorded once they are shown.
+func (s *status) fetched(source string, err error, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = source
+	s.lastFetch = at
+	if err != nil {
+		s.lastError = err.Error()
+		s.errors++
+		return
+	}
+
+	s.lastSuccess = at
+	s.lastError = ""
+}
+
+// fellBack records source as the one shown, used when fetching failed,
+// without touching the outcome of the fetch.
+func (s *status) fellBack(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = source
+}
+
+// shown records the buses sent to the display, along with the ones
+// heard on the websocket.
+func (s *status) shown(buses []arrivals.Bus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.arrivals = buses
+}
+
+// Arrivals returns the buses last sent to the display.
+func (s *status) Arrivals() []arrivals.Bus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]arrivals.Bus(nil), s.arrivals...)
+}
+
+// Health returns a summary of the recent fetches.
+func (s *status) Health() health {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return health{
+		Source:      s.source,
+		LastFetch:   s.lastFetch,
+		LastSuccess: s.lastSuccess,
+		LastError:   s.lastError,
+		Errors:      s.errors,
+		Arrivals:    len(s.arrivals),
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+// stops finds stop areas by name or town, or nearest to a location, and prints
+// the lines and destinations served there with a config snippet to watch them, e.g.
+// `stops olof palmeplein` or `stops -near 52.378,4.823`. It returns the exit code.
+func stops(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("stops", flag.ContinueOnError)
+	near := fs.String("near", "", "find the stops nearest to this `lat,lon` instead")
+	n := fs.Int("n", 5, "show at most this many stops")
+	cache := fs.String("cache", defaultStopCache(), "keep the list of stops in this file, empty to always fetch it")
+	maxAge := fs.Duration("max-age", time.Hour*24*7, "fetch the list of stops again when the cache is older")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	query := strings.Join(fs.Args(), " ")
+	if query == "" && *near == "" {
+		fmt.Fprintln(os.Stderr, "pass a name or town to search for, or -near lat,lon")
+		return 2
+	}
+
+	ctx := context.Background()
+	oc := ovapi.NewClient(nil)
+	oc.Every = cfg.RequestInterval.Duration
+
+	areas, err := loadStopAreas(ctx, oc, *cache, *maxAge)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var found []ovapi.StopArea
+	var lat, lon float64
+	if *near != "" {
+		if _, err := fmt.Sscanf(*near, "%f,%f", &lat, &lon); err != nil {
+			fmt.Fprintf(os.Stderr, "-near must look like `52.378,4.823`, passed: %v\n", *near)
+			return 2
+		}
+		found = ovapi.Nearest(ovapi.Search(areas, query), lat, lon)
+	} else {
+		found = ovapi.Search(areas, query)
+	}
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, "no stops found")
+		return 1
+	}
+	if len(found) > *n {
+		fmt.Printf("%d stops found, showing the first %d\n\n", len(found), *n)
+		found = found[:*n]
+	}
+
+	var watches []config.Watch
+	for _, a := range found {
+		fmt.Printf("%v  %v, %v", a.StopAreaCode, a.TimingPointName, a.TimingPointTown)
+		if *near != "" {
+			fmt.Printf("  %.0f m", a.Distance(lat, lon))
+		}
+		fmt.Println()
+
+		d, err := oc.Departures(ctx, a.StopAreaCode)
+		if err != nil {
+			fmt.Printf("  could not fetch departures: %v\n\n", err)
+			continue
+		}
+		served := servedBy(d)
+		if len(served) == 0 {
+			fmt.Printf("  no departures right now\n\n")
+			continue
+		}
+		for _, s := range served {
+			fmt.Printf("  %v  %v direction %d to %v\n", s.timingPoint, s.line, s.direction, strings.Join(s.destinations, ", "))
+			watches = append(watches, watchOf(a, s))
+		}
+		fmt.Println()
+	}
+
+	if len(watches) == 0 {
+		return 0
+	}
+	b, err := json.MarshalIndent(struct {
+		Watches []config.Watch `json:"watches"`
+	}{watches}, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("Keep the watches you want in the config:")
+	fmt.Println(string(b))
+	return 0
+}
+
+// served is a line passing a timing point in one direction.
+type served struct {
+	timingPoint  string
+	line         string
+	direction    int
+	destinations []string // code and name
+}
+
+// watchOf returns a watch of s at a. Its name has the timing point, as stop
+// areas of the same name, or the timing points of one, may serve the same line.
+func watchOf(a ovapi.StopArea, s served) config.Watch {
+	return config.Watch{
+		Name:         fmt.Sprintf("%v %v-%d %v", a.TimingPointName, s.line, s.direction, s.timingPoint),
+		StopAreaCode: a.StopAreaCode,
+		Lines:        []string{s.line},
+		Direction:    s.direction,
+		TimingPoints: []string{s.timingPoint},
+	}
+}
+
+// servedBy returns the lines passing the timing points of d, ordered by timing point, line and direction.
+func servedBy(d ovapi.Departures) []served {
+	type key struct {
+		timingPoint, line string
+		direction         int
+	}
+	dests := map[key]map[string]bool{}
+	for _, pass := range d.Passes() {
+		k := key{pass.TimingPointCode, pass.LinePublicNumber, pass.LineDirection}
+		if dests[k] == nil {
+			dests[k] = map[string]bool{}
+		}
+		dests[k][pass.DestinationCode+" "+pass.DestinationName50] = true
+	}
+
+	var out []served
+	for k, set := range dests {
+		s := served{timingPoint: k.timingPoint, line: k.line, direction: k.direction}
+		for dest := range set {
+			s.destinations = append(s.destinations, dest)
+		}
+		sort.Strings(s.destinations)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.timingPoint != b.timingPoint {
+			return a.timingPoint < b.timingPoint
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.direction < b.direction
+	})
+	return out
+}
+
+// loadStopAreas returns the cached list of stop areas, fetching it when the cache is
+// missing or older than maxAge. An empty cache path always fetches.
+func loadStopAreas(ctx context.Context, oc *ovapi.Client, cache string, maxAge time.Duration) ([]ovapi.StopArea, error) {
+	if cache != "" {
+		if fi, err := os.Stat(cache); err == nil && time.Since(fi.ModTime()) < maxAge {
+			var areas []ovapi.StopArea
+			b, err := ioutil.ReadFile(cache)
+			if err == nil && json.Unmarshal(b, &areas) == nil {
+				return areas, nil
+			}
+		}
+	}
+
+	areas, err := oc.StopAreas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the stops: %v", err)
+	}
+
+	if cache != "" {
+		b, err := json.Marshal(areas)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(cache), 0755)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(cache, b, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not cache the stops: %v\n", err)
+		}
+	}
+	return areas, nil
+}
+
+// defaultStopCache is where the list of stops is kept, empty when there is no cache directory.
+func defaultStopCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-unicord-phat-lucian", "stopareas.json")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.org/go-unicord-phat-lucian/config"
+	"gitlab.org/go-unicord-phat-lucian/ovapi"
+)
+
+func TestServedBy(t *testing.T) {
+	var d ovapi.Departures
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"30001346": {"Passes": {
+			"a": {"TimingPointCode": "30001346", "LinePublicNumber": "35", "LineDirection": 2, "DestinationCode": "OLPP", "DestinationName50": "Olof Palmeplein"},
+			"b": {"TimingPointCode": "30001346", "LinePublicNumber": "35", "LineDirection": 2, "DestinationCode": "SLML", "DestinationName50": "Slotermeerlaan"},
+			"c": {"TimingPointCode": "30001346", "LinePublicNumber": "35", "LineDirection": 2, "DestinationCode": "OLPP", "DestinationName50": "Olof Palmeplein"}
+		}},
+		"30001345": {"Passes": {
+			"d": {"TimingPointCode": "30001345", "LinePublicNumber": "35", "LineDirection": 1, "DestinationCode": "STZD", "DestinationName50": "Station Zuid"}
+		}}
+	}`), &d))
+
+	assert.Equal(t, []served{
+		{timingPoint: "30001345", line: "35", direction: 1, destinations: []string{"STZD Station Zuid"}},
+		{timingPoint: "30001346", line: "35", direction: 2, destinations: []string{"OLPP Olof Palmeplein", "SLML Slotermeerlaan"}},
+	}, servedBy(d))
+}
+
+func TestWatchOf(t *testing.T) {
+	cfg := config.Default()
+	cfg.Watches = []config.Watch{
+		watchOf(ovapi.StopArea{StopAreaCode: "01346", TimingPointName: "Olof Palmeplein"}, served{timingPoint: "30001346", line: "35", direction: 2}),
+		watchOf(ovapi.StopArea{StopAreaCode: "01347", TimingPointName: "Olof Palmeplein"}, served{timingPoint: "30001347", line: "35", direction: 2}),
+	}
+	assert.Equal(t, config.Watch{
+		Name:         "Olof Palmeplein 35-2 30001346",
+		StopAreaCode: "01346",
+		Lines:        []string{"35"},
+		Direction:    2,
+		TimingPoints: []string{"30001346"},
+	}, cfg.Watches[0])
+	assert.NoError(t, cfg.Validate(), "stops of the same name make unique watches")
+}
@@ -27,7 +27,7 @@ func Connect() (*Hat, error) {
 }
 
 func ConnectToSocket(path string) (*Hat, error) {
-	socket, err := net.Dial("unix", SocketPath)
+	socket, err := net.Dial("unix", path)
 
 	if err != nil {
 		return nil, err
@@ -88,6 +88,10 @@ func (uh *Hat) Clear() error {
 }
 
 func (uh *Hat) Close() error {
+	if uh.socket == nil {
+		return nil
+	}
+
 	err := uh.socket.Close()
 	uh.socket = nil
 
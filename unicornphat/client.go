@@ -4,43 +4,59 @@ import (
 	"fmt"
 	"github.com/lunixbochs/struc"
 	"net"
+	"strings"
+
+	"gitlab.org/go-unicord-phat-lucian/logger"
 )
 
+// packOptions are passed to struc, whose defaults are written on every call:
+// the panels of a Composite are written to at the same time.
+var packOptions = &struc.Options{PtrSize: 32}
+
 // Client is the unix socket client for `unicornd`.
 type Client struct {
-	Path    string
-	sock    net.Conn
-	verbose bool
+	Path string
+
+	// Transform maps matrices passed to SetMatrix onto the board.
+	Transform Transform
+
+	// Log gets every call at debug level. Nil logs nothing.
+	Log *logger.Logger
+
+	sock net.Conn
 }
 
-// NewClient returns a new unicorn Client.
+// NewClient returns a new unicorn Client logging to log, which may be nil.
 // If no socket is specified, it will use a default. Omit if unsure.
-func NewClient(verbose bool, socketPath string) *Client {
+func NewClient(log *logger.Logger, socketPath string) *Client {
 	if socketPath == "" {
 		socketPath = SocketPath
 	}
 
 	return &Client{
-		Path:    socketPath,
-		verbose: verbose,
+		Path: socketPath,
+		Log:  log.With("component", "unicorn", "socket", socketPath),
 	}
 }
 
 // Connect opens a connection to the Client.Path
+// A path in the form of `tcp://host:port` connects to a unicornd socket
+// forwarded over the network, e.g. from another Pi.
 func (c *Client) Connect() (err error) {
-	if c.verbose {
-		fmt.Printf("Connecting to (%v)...\n", SocketPath)
+	c.Log.Debug("connecting")
+
+	if strings.HasPrefix(c.Path, "tcp://") {
+		c.sock, err = net.Dial("tcp", strings.TrimPrefix(c.Path, "tcp://"))
+		return err
 	}
-	c.sock, err = net.Dial("unix", SocketPath)
+	c.sock, err = net.Dial("unix", c.Path)
 
 	return err
 }
 
 // SetBrightness of the display, 0..255
 func (c Client) SetBrightness(v uint) error {
-	if c.verbose {
-		fmt.Printf("Setting brightness to (%v)\n", v)
-	}
+	c.Log.Debug("setting brightness", "level", v)
 
 	if v > 255 {
 		return fmt.Errorf("brightness must be 0..255, passed: %v", v)
@@ -51,14 +67,12 @@ func (c Client) SetBrightness(v uint) error {
 		Val:  v,
 	}
 
-	return struc.Pack(c.sock, &b)
+	return struc.PackWithOptions(c.sock, &b, packOptions)
 }
 
 // SetPixel sets the color of an individual pixel.
 func (c Client) SetPixel(x, y, r, g, b uint) error {
-	if c.verbose {
-		fmt.Printf("Setting pixel `x:%v`, `y:%v` to rgb(%v, %v, %v)\n", x, y, r, g, b)
-	}
+	c.Log.Debug("setting pixel", "x", x, "y", y, "r", r, "g", g, "b", b)
 
 	switch {
 	case x > 7 || y > 7:
@@ -87,14 +101,12 @@ func (c Client) SetPixel(x, y, r, g, b uint) error {
 	//bw, err := c.sock.Write(buf.Bytes())
 	//return err
 
-	return struc.Pack(c.sock, &sp)
+	return struc.PackWithOptions(c.sock, &sp, packOptions)
 }
 
 // SetAllPixels allows you to set the color of all pixels in a single call.
 func (c Client) SetAllPixels(ps [64]Pixel) error {
-	if c.verbose {
-		fmt.Println("Setting all pixels...")
-	}
+	c.Log.Debug("setting all pixels")
 
 	for i := range ps {
 		if ps[i].R > 255 || ps[i].G > 255 || ps[i].B > 255 {
@@ -105,43 +117,61 @@ func (c Client) SetAllPixels(ps [64]Pixel) error {
 	}
 
 	sp := setAll{
-		Code:   CMDSetAllPixels,
-		Pixels: ps,
+		Code: CMDSetAllPixels,
 	}
-	return struc.Pack(c.sock, &sp)
+	for i := range ps {
+		sp.Pixels[i] = Pixel{
+			R: ps[i].G, // same bug as in SetPixel
+			G: ps[i].R,
+			B: ps[i].B,
+		}
+	}
+	return struc.PackWithOptions(c.sock, &sp, packOptions)
+}
+
+// SetMatrix sets all pixels from a logical matrix,
+// mapped onto the board by the Client.Transform.
+func (c Client) SetMatrix(m Matrix) error {
+	return c.SetAllPixels(DeMatrix(c.Transform.Apply(m)))
+}
+
+// SetCanvas sets all pixels from the top left 8x8 pixels of cv,
+// mapped onto the board by the Client.Transform.
+func (c Client) SetCanvas(cv *Canvas) error {
+	return c.SetMatrix(cv.Matrix(0, 0))
 }
 
 // Show the pixels written to the buffer.
 func (c Client) Show() error {
-	if c.verbose {
-		fmt.Println("Displaying pixels")
-	}
+	c.Log.Debug("displaying pixels")
 
 	s := show{
 		Code: CMDShow,
 	}
 
-	return struc.Pack(c.sock, &s)
+	return struc.PackWithOptions(c.sock, &s, packOptions)
 }
 
 // Clear sets all pixels to 0,0,0.
 // wrapper for Client.SetAllPixels([64]Pixel{})
 func (c Client) Clear() error {
-	if c.verbose {
-		fmt.Println("Display cleared")
+	c.Log.Debug("clearing display")
+	if err := c.SetAllPixels([64]Pixel{}); err != nil {
+		return err
 	}
-	c.SetAllPixels([64]Pixel{})
-	c.Show()
 
-	return nil
+	return c.Show()
 }
 
-// Silent suppresses writing to stdout.
-func (c *Client) Silent() {
-	c.verbose = false
-}
+// Close closes the connection to unicornd.
+func (c *Client) Close() error {
+	c.Log.Debug("closing connection")
+	if c.sock == nil {
+		return nil
+	}
 
-// Verbose shows the true therapeutic nature of this program.
-func (c *Client) Verbose() {
-	c.verbose = true
+	err := c.sock.Close()
+	c.sock = nil
+
+	return err
 }
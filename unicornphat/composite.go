@@ -0,0 +1,231 @@
+package unicorn
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Canvas is a logical drawing surface of arbitrary size.
+// It is used when several panels are chained into one wider display.
+type Canvas struct {
+	Width  int
+	Height int
+	Pix    []Pixel
+}
+
+// NewCanvas returns a black canvas of w by h pixels.
+func NewCanvas(w, h int) *Canvas {
+	return &Canvas{
+		Width:  w,
+		Height: h,
+		Pix:    make([]Pixel, w*h),
+	}
+}
+
+// At returns the pixel at x, y. Pixels outside the canvas are Black.
+func (cv *Canvas) At(x, y int) Pixel {
+	if x < 0 || y < 0 || x >= cv.Width || y >= cv.Height {
+		return Black
+	}
+	return cv.Pix[y*cv.Width+x]
+}
+
+// Set colors the pixel at x, y. Pixels outside the canvas are ignored.
+func (cv *Canvas) Set(x, y int, p Pixel) {
+	if x < 0 || y < 0 || x >= cv.Width || y >= cv.Height {
+		return
+	}
+	cv.Pix[y*cv.Width+x] = p
+}
+
+// Clear sets all pixels of the canvas to Black.
+func (cv *Canvas) Clear() {
+	for i := range cv.Pix {
+		cv.Pix[i] = Black
+	}
+}
+
+// Window returns a copy of the w by h window starting at x, y of the canvas.
+func (cv *Canvas) Window(x, y, w, h int) *Canvas {
+	out := NewCanvas(w, h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			out.Set(i, j, cv.At(x+i, y+j))
+		}
+	}
+	return out
+}
+
+// DrawMatrix copies m onto the canvas with its top left corner at x, y.
+func (cv *Canvas) DrawMatrix(m Matrix, x, y int) {
+	for i := range m {
+		for j := range m[i] {
+			cv.Set(x+i, y+j, m[i][j])
+		}
+	}
+}
+
+// Matrix cuts the 8x8 window starting at x, y out of the canvas.
+func (cv *Canvas) Matrix(x, y int) Matrix {
+	m := Matrix{}
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			m[i][j] = cv.At(x+i, y+j)
+		}
+	}
+	return m
+}
+
+// Panel is a single physical display taking part in a Composite.
+type Panel struct {
+	Client *Client
+
+	// X and Y are the offset of the panel's top left corner on the canvas.
+	// The size, rotation and pixel order of the panel are taken from Client.Transform.
+	X int
+	Y int
+}
+
+// Composite maps one logical canvas onto several chained panels,
+// e.g. two pHATs on two Pis, each with their own unicornd socket.
+// As a Display it is as large as its canvas: pixels set are pushed on Show.
+type Composite struct {
+	Width  int
+	Height int
+	Panels []Panel
+
+	mu  sync.Mutex
+	buf *Canvas // set by SetMatrix and SetCanvas
+}
+
+var _ Display = (*Composite)(nil)
+
+// NewComposite returns a Composite whose canvas is just large enough
+// to hold all panels at their offsets.
+func NewComposite(panels ...Panel) *Composite {
+	c := &Composite{Panels: panels}
+	for _, p := range panels {
+		w, h := p.Client.Transform.Size()
+		if p.X+w > c.Width {
+			c.Width = p.X + w
+		}
+		if p.Y+h > c.Height {
+			c.Height = p.Y + h
+		}
+	}
+	c.buf = c.Canvas()
+	return c
+}
+
+// Canvas returns an empty canvas matching the size of the composite.
+func (c *Composite) Canvas() *Canvas {
+	return NewCanvas(c.Width, c.Height)
+}
+
+// Connect opens the connection of every panel. When one fails,
+// the ones already opened are closed again.
+func (c *Composite) Connect() error {
+	for i, p := range c.Panels {
+		if err := p.Client.Connect(); err != nil {
+			for _, opened := range c.Panels[:i] {
+				opened.Client.Close()
+			}
+			return fmt.Errorf("panel %d (%v): %v", i, p.Client.Path, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection of every panel.
+func (c *Composite) Close() error {
+	var first error
+	for i, p := range c.Panels {
+		if err := p.Client.Close(); err != nil && first == nil {
+			first = fmt.Errorf("panel %d (%v): %v", i, p.Client.Path, err)
+		}
+	}
+	return first
+}
+
+// SetBrightness of all panels, 0..255
+func (c *Composite) SetBrightness(v uint) error {
+	return c.each(func(p Panel) error {
+		return p.Client.SetBrightness(v)
+	})
+}
+
+// Push sends the canvas to all panels and shows it.
+// All panels are loaded first and only then shown together,
+// so content moving over the seam between two panels stays in sync.
+func (c *Composite) Push(cv *Canvas) error {
+	err := c.each(func(p Panel) error {
+		return p.Client.SetMatrix(cv.Matrix(p.X, p.Y))
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.each(func(p Panel) error {
+		return p.Client.Show()
+	})
+}
+
+// SetMatrix sets the top left 8x8 pixels of the canvas from a logical matrix,
+// and the rest to 0,0,0.
+func (c *Composite) SetMatrix(m Matrix) error {
+	cv := c.Canvas()
+	cv.DrawMatrix(m, 0, 0)
+	return c.SetCanvas(cv)
+}
+
+// SetCanvas sets the pixels of the canvas from cv, from its top left corner.
+func (c *Composite) SetCanvas(cv *Canvas) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = cv.Window(0, 0, c.Width, c.Height)
+
+	return nil
+}
+
+// Show pushes the pixels set to all panels.
+func (c *Composite) Show() error {
+	c.mu.Lock()
+	cv := c.buf
+	c.mu.Unlock()
+
+	return c.Push(cv)
+}
+
+// Clear sets all pixels of all panels to 0,0,0.
+// Each panel is cleared on its own, so one that is gone leaves the others dark.
+func (c *Composite) Clear() error {
+	c.mu.Lock()
+	c.buf = c.Canvas()
+	c.mu.Unlock()
+
+	return c.each(func(p Panel) error {
+		return p.Client.Clear()
+	})
+}
+
+// each runs fn for all panels concurrently and returns the first error.
+func (c *Composite) each(fn func(p Panel) error) error {
+	errs := make([]error, len(c.Panels))
+
+	var wg sync.WaitGroup
+	for i := range c.Panels {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(c.Panels[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("panel %d (%v): %v", i, c.Panels[i].Client.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package unicorn
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePanel is a unicornd socket recording what is sent to it until the client closes it.
+type fakePanel struct {
+	client *Client
+	got    bytes.Buffer
+	done   chan struct{}
+}
+
+func newFakePanel(t Transform) *fakePanel {
+	ours, theirs := net.Pipe()
+	p := &fakePanel{
+		client: &Client{Path: "fake", Transform: t, sock: ours},
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		io.Copy(&p.got, theirs)
+	}()
+	return p
+}
+
+// frames returns the unicornd pixels of every set all pixels command received,
+// by x and y, and how often it was told to show them.
+func (p *fakePanel) frames() (frames []Matrix, shows int) {
+	<-p.done
+	b := p.got.Bytes()
+	for len(b) > 0 {
+		switch uint(b[0]) {
+		case CMDSetAllPixels:
+			var m Matrix
+			for i := 0; i < 64; i++ {
+				px := b[1+i*3:]
+				m[i/8][i%8] = Pixel{R: uint(px[1]), G: uint(px[0]), B: uint(px[2])} // swapped, like unicornd
+			}
+			frames = append(frames, m)
+			b = b[1+64*3:]
+		case CMDShow:
+			shows++
+			b = b[1:]
+		default:
+			b = b[2:] // brightness
+		}
+	}
+	return frames, shows
+}
+
+func TestCompositePush(t *testing.T) {
+	pHAT := Transform{Width: 8, Height: 4}
+	left, right, below := newFakePanel(pHAT), newFakePanel(pHAT), newFakePanel(pHAT)
+	c := NewComposite(
+		Panel{Client: left.client},
+		Panel{Client: right.client, X: 8},
+		Panel{Client: below.client, X: 4, Y: 4},
+	)
+	assert.Equal(t, 16, c.Width)
+	assert.Equal(t, 8, c.Height)
+
+	cv := c.Canvas()
+	cv.Set(0, 0, Red)
+	cv.Set(7, 3, Green)
+	cv.Set(8, 0, Blue)  // the first pixel of the right panel
+	cv.Set(15, 3, Cyan) // and its last
+	cv.Set(5, 5, White) // below, 1 from its left and top
+	assert.NoError(t, c.SetCanvas(cv))
+	assert.NoError(t, c.Show())
+	assert.NoError(t, c.Close())
+
+	for _, p := range []*fakePanel{left, right, below} {
+		frames, shows := p.frames()
+		assert.Len(t, frames, 1)
+		assert.Equal(t, 1, shows)
+	}
+
+	var want Matrix
+	want[0][0], want[7][3] = Red, Green
+	frames, _ := left.frames()
+	assert.Equal(t, want, frames[0])
+
+	want = Matrix{}
+	want[0][0], want[7][3] = Blue, Cyan
+	frames, _ = right.frames()
+	assert.Equal(t, want, frames[0])
+
+	want = Matrix{}
+	want[1][1] = White
+	frames, _ = below.frames()
+	assert.Equal(t, want, frames[0])
+}
+
+func TestCompositeDisplay(t *testing.T) {
+	p := newFakePanel(Transform{Width: 8, Height: 4})
+	var d Display = NewComposite(Panel{Client: p.client})
+
+	var m Matrix
+	m[2][1] = Orange
+	assert.NoError(t, d.SetMatrix(m))
+	assert.NoError(t, d.Show())
+	assert.NoError(t, d.Clear())
+	assert.NoError(t, d.Close())
+
+	frames, shows := p.frames()
+	if assert.Len(t, frames, 2) {
+		assert.Equal(t, m, frames[0])
+		assert.Equal(t, Matrix{}, frames[1])
+	}
+	assert.Equal(t, 2, shows)
+}
+
+func TestCompositeClear(t *testing.T) {
+	ours, theirs := net.Pipe()
+	theirs.Close()
+	gone := &Client{Path: "gone", sock: ours}
+	p := newFakePanel(Transform{Width: 8, Height: 4})
+	c := NewComposite(Panel{Client: gone}, Panel{Client: p.client, X: 8})
+
+	assert.Error(t, c.Clear())
+	assert.NoError(t, c.Close())
+
+	frames, shows := p.frames()
+	assert.Equal(t, []Matrix{{}}, frames)
+	assert.Equal(t, 1, shows)
+}
+
+func TestCompositeConnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unicornd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "unicornd.socket")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	ok := &Client{Path: path}
+	missing := &Client{Path: filepath.Join(dir, "missing.socket")}
+	c := NewComposite(Panel{Client: ok}, Panel{Client: missing, X: 8})
+
+	// The panel that connected is closed again.
+	assert.Error(t, c.Connect())
+	assert.Nil(t, ok.sock)
+	assert.Nil(t, missing.sock)
+}
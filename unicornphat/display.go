@@ -0,0 +1,108 @@
+package unicorn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Display is what pixels are drawn on: a Client driving a board,
+// or a Terminal emulating one.
+type Display interface {
+	SetBrightness(v uint) error
+	SetMatrix(m Matrix) error
+	SetCanvas(cv *Canvas) error // the logical display from the top left corner of cv
+	Show() error
+	Clear() error
+	Close() error
+}
+
+var (
+	_ Display = (*Client)(nil)
+	_ Display = (*Terminal)(nil)
+)
+
+// Terminal emulates a display on a terminal with 24-bit colour, e.g. to try
+// things out without a Pi. Every pixel is a block two columns wide, and each
+// Show redraws the display in place.
+type Terminal struct {
+	w             io.Writer
+	width, height int
+
+	mu         sync.Mutex
+	buf        *Canvas
+	brightness uint
+	drawn      bool
+}
+
+// NewTerminal returns a logical display of width by height pixels drawn on w.
+func NewTerminal(w io.Writer, width, height int) *Terminal {
+	return &Terminal{w: w, width: width, height: height, buf: NewCanvas(width, height), brightness: 255}
+}
+
+// SetBrightness dims the pixels, 0..255. Even at 0 they stay visible, as a
+// terminal is not as bright as the LEDs.
+func (t *Terminal) SetBrightness(v uint) error {
+	if v > 255 {
+		return fmt.Errorf("brightness must be 0..255, passed: %v", v)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.brightness = v
+
+	return nil
+}
+
+// SetMatrix sets all pixels from a logical matrix.
+func (t *Terminal) SetMatrix(m Matrix) error {
+	cv := NewCanvas(t.width, t.height)
+	cv.DrawMatrix(m, 0, 0)
+	return t.SetCanvas(cv)
+}
+
+// SetCanvas sets all pixels from the top left corner of cv.
+func (t *Terminal) SetCanvas(cv *Canvas) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = cv.Window(0, 0, t.width, t.height)
+
+	return nil
+}
+
+// Show draws the pixels set, over the previous frame.
+func (t *Terminal) Show() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w := bufio.NewWriter(t.w)
+	if t.drawn {
+		fmt.Fprintf(w, "\x1b[%dA", t.height) // back to the top of the previous frame
+	}
+	t.drawn = true
+
+	scale := 64 + t.brightness*191/255
+	for y := 0; y < t.height; y++ {
+		for x := 0; x < t.width; x++ {
+			p := t.buf.At(x, y)
+			fmt.Fprintf(w, "\x1b[48;2;%d;%d;%dm  ", p.R*scale/255, p.G*scale/255, p.B*scale/255)
+		}
+		fmt.Fprint(w, "\x1b[0m\n")
+	}
+
+	return w.Flush()
+}
+
+// Clear sets all pixels to 0,0,0.
+func (t *Terminal) Clear() error {
+	if err := t.SetMatrix(Matrix{}); err != nil {
+		return err
+	}
+	return t.Show()
+}
+
+// Close leaves the last frame on the terminal.
+func (t *Terminal) Close() error {
+	return nil
+}
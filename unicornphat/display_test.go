@@ -0,0 +1,29 @@
+package unicorn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+	term := NewTerminal(&out, 2, 1)
+
+	var m Matrix
+	m[1][0] = Pixel{R: 255}
+	assert.NoError(t, term.SetMatrix(m))
+	assert.NoError(t, term.Show())
+	assert.Equal(t, "\x1b[48;2;0;0;0m  \x1b[48;2;255;0;0m  \x1b[0m\n", out.String())
+
+	// Redrawn in place, dimmed.
+	out.Reset()
+	assert.NoError(t, term.SetBrightness(0))
+	assert.NoError(t, term.Show())
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b[1A"))
+	assert.Contains(t, out.String(), "\x1b[48;2;64;0;0m")
+
+	assert.Error(t, term.SetBrightness(256))
+}
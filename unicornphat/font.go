@@ -0,0 +1,103 @@
+package unicorn
+
+import "unicode"
+
+// FontHeight is the height of every glyph in Font.
+const FontHeight = 4
+
+// Font is a tiny font that fits the 4 rows of a pHAT, one string per row.
+// Glyphs are 3 pixels wide unless they need less.
+// Lower case letters are drawn as upper case.
+var Font = map[rune][]string{
+	'0': {"###", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#."},
+	'2': {".##", "#.#", ".#.", "###"},
+	'3': {"###", ".##", "..#", "###"},
+	'4': {"#..", "###", "..#", "..#"},
+	'5': {"###", "#..", ".#.", "###"},
+	'6': {"###", "#..", "###", "###"},
+	'7': {"###", "..#", ".#.", "#.."},
+	'8': {"###", "#.#", "###", "###"},
+	'9': {"###", "###", "..#", "..#"},
+
+	'A': {".#.", "#.#", "###", "#.#"},
+	'B': {"##.", "###", "#.#", "###"},
+	'C': {"###", "#..", "#..", "###"},
+	'D': {"##.", "#.#", "#.#", "##."},
+	'E': {"###", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#.."},
+	'G': {"###", "#..", "#.#", "###"},
+	'H': {"#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "#.#", "###"},
+	'K': {"#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "###"},
+	'M': {"###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#"},
+	'O': {"###", "#.#", "#.#", "###"},
+	'P': {"###", "#.#", "###", "#.."},
+	'Q': {"###", "#.#", "###", "..#"},
+	'R': {"##.", "#.#", "##.", "#.#"},
+	'S': {".##", "#..", "..#", "##."},
+	'T': {"###", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "###"},
+	'V': {"#.#", "#.#", "#.#", ".#."},
+	'W': {"#.#", "#.#", "###", "###"},
+	'X': {"#.#", ".#.", ".#.", "#.#"},
+	'Y': {"#.#", "#.#", ".#.", ".#."},
+	'Z': {"###", "..#", "#..", "###"},
+
+	' ':  {"..", "..", "..", ".."},
+	'.':  {".", ".", ".", "#"},
+	',':  {".", ".", "#", "#"},
+	':':  {".", "#", ".", "#"},
+	'!':  {"#", "#", ".", "#"},
+	'\'': {"#", "#", ".", "."},
+	'-':  {"...", "###", "...", "..."},
+	'+':  {"...", ".#.", "###", ".#."},
+	'/':  {"..#", ".#.", ".#.", "#.."},
+	'~':  {"...", "##.", ".##", "..."},
+	'?':  {"##.", "..#", ".#.", ".#."},
+}
+
+// Glyph returns the Font glyph for r, `?` if there is none.
+func Glyph(r rune) []string {
+	if g, ok := Font[unicode.ToUpper(r)]; ok {
+		return g
+	}
+	return Font['?']
+}
+
+// TextWidth returns the width of s in pixels when drawn with DrawText.
+func TextWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += len(Glyph(r)[0]) + 1
+	}
+	if w > 0 {
+		w-- // no spacing after the last glyph
+	}
+	return w
+}
+
+// DrawText draws s onto the canvas with its top left corner at x, y,
+// leaving one pixel between glyphs. It returns the x following the text.
+func DrawText(cv *Canvas, x, y int, s string, p Pixel) int {
+	for _, r := range s {
+		g := Glyph(r)
+		DrawGlyph(cv, g, x, y, p)
+		x += len(g[0]) + 1
+	}
+	return x
+}
+
+// DrawGlyph colors the `#` pixels of g with its top left corner at x, y.
+func DrawGlyph(cv *Canvas, g []string, x, y int, p Pixel) {
+	for j, row := range g {
+		for i, ch := range row {
+			if ch == '#' {
+				cv.Set(x+i, y+j, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package unicorn
+
+// Names of the pictograms in Icons.
+const (
+	IconBus   = "bus"
+	IconTram  = "tram"
+	IconMetro = "metro"
+	IconFerry = "ferry"
+)
+
+// Icons are 8x8 pictograms of the vehicles, for the HAT, one string per row.
+var Icons = map[string][]string{
+	IconBus: {
+		".######.",
+		"#......#",
+		"#......#",
+		"########",
+		"########",
+		"#.####.#",
+		"########",
+		".#....#.",
+	},
+	IconTram: {
+		"...##...",
+		"..#..#..",
+		".######.",
+		".#....#.",
+		".#....#.",
+		".######.",
+		".#.##.#.",
+		"#......#",
+	},
+	IconMetro: {
+		"########",
+		"#......#",
+		"#.#..#.#",
+		"#.####.#",
+		"#.#..#.#",
+		"#.#..#.#",
+		"#......#",
+		"########",
+	},
+	IconFerry: {
+		"...#....",
+		"...##...",
+		"...###..",
+		"...#....",
+		"########",
+		".######.",
+		"..####..",
+		"#.#.#.#.",
+	},
+}
+
+// SmallIcons are the Icons in FontHeight rows, for the pHAT.
+var SmallIcons = map[string][]string{
+	IconBus: {
+		"#######.",
+		"#.#.#.##",
+		"########",
+		".#...#..",
+	},
+	IconTram: {
+		"...#...",
+		"#######",
+		"#.#.#.#",
+		"##.#.##",
+	},
+	IconMetro: {
+		"#...#",
+		"##.##",
+		"#.#.#",
+		"#...#",
+	},
+	IconFerry: {
+		"..#....",
+		"..##...",
+		"#######",
+		".#####.",
+	},
+}
+
+// Icon returns the tallest pictogram called name that fits in height rows,
+// nil when there is none.
+func Icon(name string, height int) []string {
+	if g, ok := Icons[name]; ok && len(g) <= height {
+		return g
+	}
+	if g, ok := SmallIcons[name]; ok && len(g) <= height {
+		return g
+	}
+	return nil
+}
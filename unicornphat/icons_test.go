@@ -0,0 +1,26 @@
+package unicorn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIcons(t *testing.T) {
+	for name, g := range Icons {
+		assert.Len(t, g, 8, name)
+		for _, row := range g {
+			assert.Len(t, row, 8, name)
+		}
+		small := SmallIcons[name]
+		assert.Len(t, small, FontHeight, name)
+		for _, row := range small {
+			assert.Len(t, row, len(small[0]), name)
+		}
+	}
+
+	assert.Equal(t, Icons[IconTram], Icon(IconTram, 8))
+	assert.Equal(t, SmallIcons[IconTram], Icon(IconTram, 4))
+	assert.Nil(t, Icon(IconTram, 3))
+	assert.Nil(t, Icon("zeppelin", 8))
+}
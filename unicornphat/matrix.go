@@ -2,7 +2,7 @@ package unicorn
 
 import "math"
 
-// Matrix is an 8x8 matrix of unicorn.Pixels
+// Matrix is an 8x8 matrix of unicorn.Pixels, indexed as m[x][y].
 type Matrix [8][8]Pixel
 
 // Supersample is a 128x128 matrix of Pixels, used for smoother shapes and antialiasing
@@ -111,3 +111,33 @@ func (m *Matrix) AddSupersample(s Supersample) {
 		}
 	}
 }
+
+// Rotation of a Matrix, clockwise.
+type Rotation int
+
+const (
+	Rotate0 Rotation = iota
+	Rotate90
+	Rotate180
+	Rotate270
+)
+
+// Rotate returns a copy of the matrix rotated clockwise by r.
+func (m Matrix) Rotate(r Rotation) Matrix {
+	n := Matrix{}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			switch r {
+			case Rotate90:
+				n[x][y] = m[y][7-x]
+			case Rotate180:
+				n[x][y] = m[7-x][7-y]
+			case Rotate270:
+				n[x][y] = m[7-y][x]
+			default:
+				n[x][y] = m[x][y]
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,257 @@
+package unicorn
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Frame is a picture of a Sprite with an opacity per pixel.
+type Frame struct {
+	Width    int
+	Height   int
+	X, Y     int           // where the frame is drawn relative to the sprite, e.g. to move it
+	Pix      []Pixel       // row by row
+	Alpha    []uint8       // opacity of Pix, 0 is transparent and 255 opaque
+	Duration time.Duration // how long the frame is shown
+}
+
+// NewFrame returns a transparent frame of w by h pixels shown for d.
+func NewFrame(w, h int, d time.Duration) Frame {
+	return Frame{
+		Width:    w,
+		Height:   h,
+		Pix:      make([]Pixel, w*h),
+		Alpha:    make([]uint8, w*h),
+		Duration: d,
+	}
+}
+
+// At returns the pixel at x, y and its opacity. Pixels outside the frame are transparent.
+func (f Frame) At(x, y int) (Pixel, uint8) {
+	if x < 0 || y < 0 || x >= f.Width || y >= f.Height {
+		return Black, 0
+	}
+	return f.Pix[y*f.Width+x], f.Alpha[y*f.Width+x]
+}
+
+// Set colors the pixel at x, y with opacity a. Pixels outside the frame are ignored.
+func (f Frame) Set(x, y int, p Pixel, a uint8) {
+	if x < 0 || y < 0 || x >= f.Width || y >= f.Height {
+		return
+	}
+	f.Pix[y*f.Width+x] = p
+	f.Alpha[y*f.Width+x] = a
+}
+
+// Faded returns a copy of f with its opacity scaled by a, e.g. 128 for half of it.
+func (f Frame) Faded(a uint8) Frame {
+	faded := f
+	faded.Alpha = make([]uint8, len(f.Alpha))
+	for i, v := range f.Alpha {
+		faded.Alpha[i] = uint8(uint(v) * uint(a) / 255)
+	}
+	return faded
+}
+
+// Draw blends f onto cv with the top left corner of its sprite at x, y.
+func (f Frame) Draw(cv *Canvas, x, y int) {
+	for j := 0; j < f.Height; j++ {
+		for i := 0; i < f.Width; i++ {
+			p, a := f.At(i, j)
+			if a == 0 {
+				continue
+			}
+			cx, cy := x+f.X+i, y+f.Y+j
+			cv.Set(cx, cy, Blend(cv.At(cx, cy), p, a))
+		}
+	}
+}
+
+// DrawMatrix blends f onto m with the top left corner of its sprite at x, y.
+func (f Frame) DrawMatrix(m *Matrix, x, y int) {
+	for j := 0; j < f.Height; j++ {
+		for i := 0; i < f.Width; i++ {
+			p, a := f.At(i, j)
+			mx, my := x+f.X+i, y+f.Y+j
+			if a == 0 || mx < 0 || my < 0 || mx >= 8 || my >= 8 {
+				continue
+			}
+			m[mx][my] = Blend(m[mx][my], p, a)
+		}
+	}
+}
+
+// Blend returns src with opacity a over dst.
+func Blend(dst, src Pixel, a uint8) Pixel {
+	mix := func(d, s uint) uint {
+		return (s*uint(a) + d*(255-uint(a))) / 255
+	}
+	return Pixel{R: mix(dst.R, src.R), G: mix(dst.G, src.G), B: mix(dst.B, src.B)}
+}
+
+// FrameFromASCII returns the frame drawn in art, one string per row, shown for d.
+// Each character is colored by palette and opaque, or transparent when it is not in it.
+// With a palette of `#` the glyphs of Font and the Icons can be used.
+func FrameFromASCII(art []string, palette map[rune]Pixel, d time.Duration) Frame {
+	w := 0
+	for _, row := range art {
+		if n := len([]rune(row)); n > w {
+			w = n
+		}
+	}
+	f := NewFrame(w, len(art), d)
+	for y, row := range art {
+		for x, ch := range []rune(row) {
+			if p, ok := palette[ch]; ok {
+				f.Set(x, y, p, 255)
+			}
+		}
+	}
+	return f
+}
+
+// FrameFromImage returns img as a frame shown for d.
+func FrameFromImage(img image.Image, d time.Duration) Frame {
+	b := img.Bounds()
+	f := NewFrame(b.Dx(), b.Dy(), d)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			f.Set(x-b.Min.X, y-b.Min.Y, Pixel{R: uint(c.R), G: uint(c.G), B: uint(c.B)}, c.A)
+		}
+	}
+	return f
+}
+
+// Sprite is an animation: its frames one after the other.
+type Sprite struct {
+	Frames []Frame
+	Loops  int // how often the frames are played, forever when 0
+}
+
+// SpriteFromASCII returns the sprite of the frames drawn in art, each shown for d
+// and played once. See FrameFromASCII.
+func SpriteFromASCII(art [][]string, palette map[rune]Pixel, d time.Duration) Sprite {
+	s := Sprite{Loops: 1}
+	for _, a := range art {
+		s.Frames = append(s.Frames, FrameFromASCII(a, palette, d))
+	}
+	return s
+}
+
+// Length returns how long it takes to play the frames once.
+func (s Sprite) Length() time.Duration {
+	var d time.Duration
+	for _, f := range s.Frames {
+		d += f.Duration
+	}
+	return d
+}
+
+// FrameAt returns the frame shown t after the sprite started playing,
+// false once it is done.
+func (s Sprite) FrameAt(t time.Duration) (Frame, bool) {
+	n := s.Length()
+	if n <= 0 || t < 0 || (s.Loops > 0 && t >= n*time.Duration(s.Loops)) {
+		return Frame{}, false
+	}
+	t %= n
+	for _, f := range s.Frames {
+		if t < f.Duration {
+			return f, true
+		}
+		t -= f.Duration
+	}
+	return Frame{}, false
+}
+
+// Draw blends the frame shown t after the sprite started onto cv with its top left
+// corner at x, y. It reports whether the sprite is still playing.
+func (s Sprite) Draw(cv *Canvas, t time.Duration, x, y int) bool {
+	f, ok := s.FrameAt(t)
+	if ok {
+		f.Draw(cv, x, y)
+	}
+	return ok
+}
+
+// DecodeGIF returns the animation of a GIF with its delays and loop count.
+// Every frame is the whole picture, with the ones before it disposed of as the GIF says.
+func DecodeGIF(r io.Reader) (Sprite, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return Sprite{}, err
+	}
+
+	var s Sprite
+	switch {
+	case g.LoopCount < 0:
+		s.Loops = 1
+	case g.LoopCount > 0:
+		s.Loops = g.LoopCount + 1 // the GIF counts the repeats
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, img := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		delay := time.Millisecond * 100 // what browsers show frames without a delay for
+		if i < len(g.Delay) && g.Delay[i] > 0 {
+			delay = time.Millisecond * 10 * time.Duration(g.Delay[i])
+		}
+		s.Frames = append(s.Frames, FrameFromImage(canvas, delay))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return s, nil
+}
+
+// LoadSprite reads a GIF animation, or a PNG shown once for still.
+func LoadSprite(path string, still time.Duration) (Sprite, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".gif" && ext != ".png" {
+		return Sprite{}, fmt.Errorf("%v: sprites must be .gif or .png, passed: %v", path, ext)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Sprite{}, err
+	}
+	defer f.Close()
+
+	if ext == ".gif" {
+		s, err := DecodeGIF(f)
+		if err != nil {
+			return Sprite{}, fmt.Errorf("%v: %v", path, err)
+		}
+		return s, nil
+	}
+	img, err := png.Decode(f)
+	if err != nil {
+		return Sprite{}, fmt.Errorf("%v: %v", path, err)
+	}
+	return Sprite{Frames: []Frame{FrameFromImage(img, still)}, Loops: 1}, nil
+}
@@ -0,0 +1,139 @@
+package unicorn
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameDraw(t *testing.T) {
+	f := FrameFromASCII([]string{
+		"#r",
+		".#",
+	}, map[rune]Pixel{'#': White, 'r': Red}, time.Second)
+	assert.Equal(t, 2, f.Width)
+	assert.Equal(t, 2, f.Height)
+
+	cv := NewCanvas(3, 2)
+	cv.Set(2, 1, Blue)
+	f.Draw(cv, 1, 0)
+	assert.Equal(t, []Pixel{Black, White, Red, Black, Black, White}, cv.Pix)
+
+	// Half transparent over blue, moved one pixel down.
+	half := f.Faded(128)
+	half.Y = 1
+	var m Matrix
+	m[1][1] = Blue
+	half.DrawMatrix(&m, 1, 0)
+	assert.Equal(t, Pixel{R: 128, G: 115, B: 242}, m[1][1])
+	assert.Equal(t, Pixel{R: 115}, m[2][1])
+	assert.Equal(t, Pixel{}, m[1][2])
+	f.DrawMatrix(&m, 7, 7) // clipped
+}
+
+func TestBlend(t *testing.T) {
+	assert.Equal(t, Red, Blend(Blue, Red, 255))
+	assert.Equal(t, Blue, Blend(Blue, Red, 0))
+	assert.Equal(t, Pixel{R: 127, G: 127, B: 127}, Blend(Black, Pixel{R: 255, G: 255, B: 255}, 127))
+}
+
+func TestSpriteFrameAt(t *testing.T) {
+	s := SpriteFromASCII([][]string{{"#"}, {"##"}}, map[rune]Pixel{'#': Green}, time.Millisecond*100)
+	s.Frames[1].Duration = time.Millisecond * 300
+	assert.Equal(t, time.Millisecond*400, s.Length())
+
+	at := func(t time.Duration) int {
+		f, ok := s.FrameAt(t)
+		if !ok {
+			return -1
+		}
+		return f.Width
+	}
+	assert.Equal(t, 1, at(0))
+	assert.Equal(t, 2, at(time.Millisecond*100))
+	assert.Equal(t, 2, at(time.Millisecond*399))
+	assert.Equal(t, -1, at(time.Millisecond*400))
+	assert.Equal(t, -1, at(-time.Millisecond))
+
+	s.Loops = 2
+	assert.Equal(t, 1, at(time.Millisecond*450))
+	assert.Equal(t, -1, at(time.Millisecond*800))
+
+	s.Loops = 0
+	assert.Equal(t, 2, at(time.Hour+time.Millisecond*100))
+
+	assert.False(t, Sprite{}.Draw(NewCanvas(8, 4), 0, 0, 0))
+}
+
+func TestDecodeGIF(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}}
+	red := image.NewPaletted(image.Rect(0, 0, 2, 1), palette)
+	red.SetColorIndex(0, 0, 1)
+	red.SetColorIndex(1, 0, 1)
+	green := image.NewPaletted(image.Rect(1, 0, 2, 1), palette) // only the right pixel
+	green.SetColorIndex(1, 0, 2)
+
+	var b bytes.Buffer
+	assert.NoError(t, gif.EncodeAll(&b, &gif.GIF{
+		Image:     []*image.Paletted{red, green},
+		Delay:     []int{5, 0},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalNone},
+		LoopCount: -1,
+		Config:    image.Config{ColorModel: palette, Width: 2, Height: 1},
+	}))
+
+	s, err := DecodeGIF(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Loops)
+	if assert.Len(t, s.Frames, 2) {
+		assert.Equal(t, time.Millisecond*50, s.Frames[0].Duration)
+		assert.Equal(t, time.Millisecond*100, s.Frames[1].Duration)
+
+		// The second frame is drawn over the first.
+		p, a := s.Frames[1].At(0, 0)
+		assert.Equal(t, Pixel{R: 255}, p)
+		assert.Equal(t, uint8(255), a)
+		p, _ = s.Frames[1].At(1, 0)
+		assert.Equal(t, Pixel{G: 255}, p)
+	}
+
+	_, err = DecodeGIF(bytes.NewReader([]byte("not a gif")))
+	assert.Error(t, err)
+}
+
+func TestLoadSprite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sprite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	img.Set(3, 2, color.NRGBA{B: 255, A: 128})
+	path := filepath.Join(dir, "icon.png")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	assert.NoError(t, f.Close())
+
+	s, err := LoadSprite(path, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, s.Length())
+	p, a := s.Frames[0].At(3, 2)
+	assert.Equal(t, Pixel{B: 255}, p)
+	assert.Equal(t, uint8(128), a)
+	_, a = s.Frames[0].At(0, 0)
+	assert.Equal(t, uint8(0), a)
+
+	_, err = LoadSprite(filepath.Join(dir, "icon.bmp"), time.Second)
+	assert.Error(t, err)
+	_, err = LoadSprite(filepath.Join(dir, "missing.png"), time.Second)
+	assert.Error(t, err)
+}
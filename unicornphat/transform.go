@@ -0,0 +1,100 @@
+package unicorn
+
+// PixelOrder describes how the LEDs of a board are chained,
+// as seen through the (x, y) grid of unicornd.
+type PixelOrder int
+
+const (
+	// Serpentine is the native order of the Unicorn HAT,
+	// unicornd already maps it to a grid.
+	Serpentine PixelOrder = iota
+
+	// RowMajor is the order of the Unicorn pHAT. unicornd expects a serpentine
+	// board, so every other row comes out mirrored unless it is corrected.
+	RowMajor
+)
+
+// Transform maps a logical Matrix onto the physical board.
+// Drawing code only deals with the logical display, mounting the board
+// upside down or sideways is a matter of changing the Transform.
+type Transform struct {
+	// Width and Height of the physical board, 8x8 if left empty.
+	Width  int
+	Height int
+
+	// Rotation of the content, clockwise.
+	Rotation Rotation
+
+	// FlipH mirrors the content left to right, FlipV top to bottom.
+	// Flips are applied before the rotation.
+	FlipH bool
+	FlipV bool
+
+	Order PixelOrder
+}
+
+// Size returns the width and height of the logical display.
+func (t Transform) Size() (w, h int) {
+	w, h = t.Width, t.Height
+	if w == 0 {
+		w = 8
+	}
+	if h == 0 {
+		h = 8
+	}
+
+	if t.Rotation == Rotate90 || t.Rotation == Rotate270 {
+		return h, w
+	}
+	return w, h
+}
+
+// Apply converts a logical Matrix into the matrix expected by unicornd.
+// Pixels outside of the logical display are dropped.
+func (t Transform) Apply(m Matrix) Matrix {
+	w, h := t.Size()
+
+	out := Matrix{}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			px, py := t.position(x, y, w, h)
+			out[px][py] = m[x][y]
+		}
+	}
+	return out
+}
+
+// position maps logical x, y on a w by h display to unicornd's x, y.
+func (t Transform) position(x, y, w, h int) (int, int) {
+	if t.FlipH {
+		x = w - 1 - x
+	}
+	if t.FlipV {
+		y = h - 1 - y
+	}
+
+	switch t.Rotation {
+	case Rotate90:
+		x, y = h-1-y, x
+	case Rotate180:
+		x, y = w-1-x, h-1-y
+	case Rotate270:
+		x, y = y, w-1-x
+	}
+
+	if t.Order == RowMajor {
+		pw := t.Width
+		if pw == 0 {
+			pw = 8
+		}
+
+		i := y*pw + x
+		row, col := i/8, i%8
+		if row%2 == 0 {
+			col = 7 - col
+		}
+		return row, col
+	}
+
+	return x, y
+}
@@ -0,0 +1,55 @@
+package unicorn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTransformSize(t *testing.T) {
+	w, h := Transform{}.Size()
+	assert.Equal(t, 8, w)
+	assert.Equal(t, 8, h)
+
+	w, h = Transform{Width: 8, Height: 4, Rotation: Rotate90}.Size()
+	assert.Equal(t, 4, w)
+	assert.Equal(t, 8, h)
+}
+
+func TestTransformApplyPHAT(t *testing.T) {
+	// The pHAT mounted upside down, as used by the bus display.
+	tr := Transform{Width: 8, Height: 4, Rotation: Rotate180, Order: RowMajor}
+
+	// A `1` in the left digit position:
+	// .#......
+	// ##......
+	// .#......
+	// .#......
+	m := Matrix{}
+	for _, p := range [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, 2}, {1, 3}} {
+		m[p[0]][p[1]] = White
+	}
+
+	// unicornd coordinates of the hand mapped glyph this replaced.
+	want := Matrix{}
+	for _, p := range [][2]int{{3, 6}, {2, 0}, {2, 1}, {1, 6}, {0, 1}} {
+		want[p[0]][p[1]] = White
+	}
+
+	assert.Equal(t, want, tr.Apply(m))
+}
+
+func TestTransformApplyHAT(t *testing.T) {
+	m := Matrix{}
+	m[0][0] = Red
+
+	got := Transform{Rotation: Rotate90}.Apply(m)
+	assert.Equal(t, Red, got[7][0])
+
+	got = Transform{FlipV: true}.Apply(m)
+	assert.Equal(t, Red, got[0][7])
+
+	got = Transform{Rotation: Rotate90, FlipH: true}.Apply(m)
+	assert.Equal(t, Red, got[7][7])
+
+	assert.Equal(t, m.Rotate(Rotate90), Transform{Rotation: Rotate90}.Apply(m))
+}
@@ -1,5 +1,11 @@
 package unicorn
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const (
 	SocketPath = "/var/run/unicornd.socket"
 )
@@ -20,3 +26,27 @@ type Pixel struct {
 	G uint `struc:"uint8"` //uint8_t g;
 	B uint `struc:"uint8"` //uint8_t b;
 }
+
+// ParseColor parses a `#rrggbb` color.
+func ParseColor(s string) (Pixel, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return Pixel{}, fmt.Errorf("color must look like `#rrggbb`, passed: %v", s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Pixel{}, fmt.Errorf("color must look like `#rrggbb`, passed: %v", s)
+	}
+
+	return Pixel{
+		R: uint(v >> 16 & 0xff),
+		G: uint(v >> 8 & 0xff),
+		B: uint(v & 0xff),
+	}, nil
+}
+
+// Hex returns the pixel as `#rrggbb`.
+func (p Pixel) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", p.R, p.G, p.B)
+}